@@ -0,0 +1,281 @@
+package copyfile
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/rrgmc/debefix"
+)
+
+// ArchiveFormat is the format of an archive file.
+type ArchiveFormat string
+
+const (
+	ArchiveZip   ArchiveFormat = "zip" // zip archive.
+	ArchiveTar   ArchiveFormat = "tar" // uncompressed tar archive.
+	ArchiveTarGz ArchiveFormat = "tgz" // gzip-compressed tar archive.
+)
+
+// IsValid returns whether the format is a known one. A blank format is valid, and means it is detected from the
+// file extension.
+func (f ArchiveFormat) IsValid() bool {
+	switch f {
+	case "", ArchiveZip, ArchiveTar, ArchiveTarGz:
+		return true
+	default:
+		return false
+	}
+}
+
+// isArchive returns whether the source must be extracted as an archive.
+func (f FileData) isArchive() bool {
+	return f.Extract || f.Format != ""
+}
+
+// archiveFormat returns the archive format of the file, detecting it from the source extension if not set.
+func archiveFormat(fileData FileData, source string) (ArchiveFormat, error) {
+	if fileData.Format != "" {
+		return fileData.Format, nil
+	}
+	lsource := strings.ToLower(source)
+	switch {
+	case strings.HasSuffix(lsource, ".zip"):
+		return ArchiveZip, nil
+	case strings.HasSuffix(lsource, ".tar"):
+		return ArchiveTar, nil
+	case strings.HasSuffix(lsource, ".tar.gz"), strings.HasSuffix(lsource, ".tgz"):
+		return ArchiveTarGz, nil
+	default:
+		return "", fmt.Errorf("cannot detect archive format of '%s'", source)
+	}
+}
+
+// archiveEntry is the position of a file in an archive, used to read its content only when it is copied.
+type archiveEntry struct {
+	source string // archive source filename.
+	format ArchiveFormat
+	index  int // index of the entry in the regular files of the archive.
+}
+
+// errStopArchive stops reading an archive.
+var errStopArchive = errors.New("stop reading archive")
+
+// extractArchive reads the source archive, calling fn for each file to write in the destination directory. Only
+// regular files are extracted, and the archive entries must not escape the destination directory. The source of each
+// file is the archive entry path joined to the archive source.
+// Files are passed to fn while the archive is read, so only one of them is kept in memory at a time. In deferred
+// and dry-run modes, only the position of the entry is passed, and its content is read by [CopyFile.Flush].
+func (c *CopyFile) extractArchive(ctx debefix.ValueResolveContext, fieldname string, fileData FileData,
+	source, destination string, fn func(expanded expandedFile) error) error {
+	format, err := archiveFormat(fileData, source)
+	if err != nil {
+		return err
+	}
+
+	file, err := c.openSource(source)
+	if err != nil {
+		if c.dryRun && errors.Is(err, fs.ErrNotExist) {
+			// the plan will report that the source doesn't exist.
+			return fn(expandedFile{source: source, destination: destination})
+		}
+		return err
+	}
+	defer file.Close()
+
+	subpath := fsPath(fileData.Subpath)
+
+	index := -1
+	var fnErr error
+	err = readArchive(format, file, func(name string, r io.Reader) error {
+		index++
+		name = strings.TrimPrefix(name, "./")
+		if !c.allowPathEscape && !isLocalPath(name) {
+			return &PathEscapeError{
+				TableID:   ctx.Table().ID,
+				RowID:     rowID(ctx.Row()),
+				FieldName: fieldname,
+				Path:      name,
+				Err:       ErrPathEscapesRoot,
+			}
+		}
+
+		rel := path.Clean(name)
+		if subpath != "." {
+			var ok bool
+			if rel, ok = strings.CutPrefix(rel, subpath+"/"); !ok {
+				return nil
+			}
+		}
+		if ok, err := matchFile(rel, "**", fileData.Include, fileData.Exclude); err != nil || !ok {
+			return err
+		}
+
+		expanded := expandedFile{
+			source:      path.Join(fsPath(source), name),
+			destination: path.Join(fsPath(destination), rel),
+			entry:       &archiveEntry{source: source, format: format, index: index},
+		}
+		if !c.isDeferred && !c.dryRun {
+			content, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			expanded.content = content
+		}
+		// errors from fn are not archive errors.
+		fnErr = fn(expanded)
+		return fnErr
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	if err != nil {
+		return fmt.Errorf("error extracting archive '%s': %w", source, err)
+	}
+	return nil
+}
+
+// archiveEntries identifies an archive whose entries are read together.
+type archiveEntries struct {
+	source string
+	format ArchiveFormat
+}
+
+// readArchiveEntries reads the archive once, calling fn for each file copy of the entries, by entry index, with its
+// content set, in archive order.
+func (c *CopyFile) readArchiveEntries(ctx context.Context, archive archiveEntries, entries map[int][]CopyFileInfo,
+	fn func(info CopyFileInfo)) error {
+	file, err := c.openSource(archive.source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	index := -1
+	remaining := len(entries)
+	err = readArchive(archive.format, file, func(name string, r io.Reader) error {
+		index++
+		infos, ok := entries[index]
+		if !ok {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		for _, info := range infos {
+			info.Content = content
+			fn(info)
+		}
+		if remaining--; remaining == 0 {
+			return errStopArchive
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errStopArchive):
+		return nil
+	case err != nil:
+		return fmt.Errorf("error extracting archive '%s': %w", archive.source, err)
+	case remaining > 0:
+		return fmt.Errorf("error extracting archive '%s': %d entries not found", archive.source, remaining)
+	default:
+		return nil
+	}
+}
+
+// readArchive calls fn for each regular file in the archive, in archive order.
+func readArchive(format ArchiveFormat, r io.Reader, fn func(name string, r io.Reader) error) error {
+	switch format {
+	case ArchiveZip:
+		zr, err := newZipReader(r)
+		if err != nil {
+			return err
+		}
+		for _, zf := range zr.File {
+			if !zf.Mode().IsRegular() {
+				continue
+			}
+			err := func() error {
+				f, err := zf.Open()
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				return fn(zf.Name, f)
+			}()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case ArchiveTarGz:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		return readTar(gr, fn)
+	case ArchiveTar:
+		return readTar(r, fn)
+	default:
+		return fmt.Errorf("invalid archive format '%s'", format)
+	}
+}
+
+// newZipReader reads the zip archive directly from r if it supports random access, like files, or from a copy of its
+// contents in memory otherwise.
+func newZipReader(r io.Reader) (*zip.Reader, error) {
+	if ra, ok := r.(io.ReaderAt); ok {
+		if file, ok := r.(interface{ Stat() (fs.FileInfo, error) }); ok {
+			stat, err := file.Stat()
+			if err != nil {
+				return nil, err
+			}
+			return zip.NewReader(ra, stat.Size())
+		}
+		if seeker, ok := r.(io.Seeker); ok {
+			size, err := seeker.Seek(0, io.SeekEnd)
+			if err != nil {
+				return nil, err
+			}
+			return zip.NewReader(ra, size)
+		}
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(data), int64(len(data)))
+}
+
+func readTar(r io.Reader, fn func(name string, r io.Reader) error) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err = fn(header.Name, tr); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package copyfile
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCopyFileExtract(t *testing.T) {
+	files := map[string]string{
+		"assets/images/logo.png": "logo image",
+		"assets/css/style.css":   "style",
+		"README.md":              "readme",
+	}
+
+	for _, test := range []struct {
+		name          string
+		source        string
+		data          []byte
+		tag           string
+		options       []Option
+		expectedFiles map[string]string
+	}{
+		{
+			name:   "zip",
+			source: "assets.zip",
+			data:   testZipArchive(t, files),
+			tag:    "extract: true",
+			expectedFiles: map[string]string{
+				"tenant/assets/images/logo.png": "logo image",
+				"tenant/assets/css/style.css":   "style",
+				"tenant/README.md":              "readme",
+			},
+		},
+		{
+			name:   "tgz subpath",
+			source: "assets.tar.gz",
+			data:   testTarArchive(t, files, true),
+			tag: `extract: true
+          subpath: "assets"`,
+			expectedFiles: map[string]string{
+				"tenant/images/logo.png": "logo image",
+				"tenant/css/style.css":   "style",
+			},
+		},
+		{
+			name:   "tar format exclude",
+			source: "assets.bin",
+			data:   testTarArchive(t, files, false),
+			tag: `format: tar
+          exclude: ["**/*.css"]`,
+			expectedFiles: map[string]string{
+				"tenant/assets/images/logo.png": "logo image",
+				"tenant/README.md":              "readme",
+			},
+		},
+		{
+			name:    "zip deferred",
+			source:  "assets.zip",
+			data:    testZipArchive(t, files),
+			tag:     "extract: true",
+			options: []Option{WithDeferred(2)},
+			expectedFiles: map[string]string{
+				"tenant/assets/images/logo.png": "logo image",
+				"tenant/assets/css/style.css":   "style",
+				"tenant/README.md":              "readme",
+			},
+		},
+		{
+			name:    "tgz deferred",
+			source:  "assets.tar.gz",
+			data:    testTarArchive(t, files, true),
+			tag:     "extract: true",
+			options: []Option{WithDeferred(2)},
+			expectedFiles: map[string]string{
+				"tenant/assets/images/logo.png": "logo image",
+				"tenant/assets/css/style.css":   "style",
+				"tenant/README.md":              "readme",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			destination := NewMemoryDestination()
+			c := New(append([]Option{
+				WithSourceFS(fstest.MapFS{
+					test.source: &fstest.MapFile{Data: test.data},
+				}),
+				WithDestination(destination),
+			}, test.options...)...)
+
+			_, err := resolveTestCopyFile(t, c, fmt.Sprintf(`tables:
+  tenants:
+    rows:
+      - tenant_id: 987
+        assets:
+          !copyfile
+          source: "%s"
+          destination: "tenant"
+          %s
+`, test.source, test.tag))
+			assert.NilError(t, err)
+			assert.NilError(t, c.Flush(context.Background()))
+
+			for file, expected := range test.expectedFiles {
+				content, err := fs.ReadFile(destination, file)
+				assert.NilError(t, err)
+				assert.Equal(t, expected, string(content))
+			}
+
+			manifest := c.Manifest()
+			assert.Equal(t, len(test.expectedFiles), len(manifest))
+			for _, entry := range manifest {
+				_, ok := test.expectedFiles[entry.Destination]
+				assert.Assert(t, ok, "unexpected destination %s", entry.Destination)
+			}
+		})
+	}
+}
+
+func TestCopyFileExtractDeferred(t *testing.T) {
+	files := map[string]string{}
+	for i := range 500 {
+		files[fmt.Sprintf("assets/file%03d.txt", i)] = fmt.Sprintf("content %d", i)
+	}
+
+	destination := NewMemoryDestination()
+	sourceFS := &openCountFS{FS: fstest.MapFS{
+		"assets.tar.gz": &fstest.MapFile{Data: testTarArchive(t, files, true)},
+	}}
+	c := New(
+		WithSourceFS(sourceFS),
+		WithDestination(destination),
+		WithDeferred(4),
+	)
+
+	_, err := resolveTestCopyFile(t, c, `tables:
+  tenants:
+    rows:
+      - tenant_id: 987
+        assets:
+          !copyfile
+          source: "assets.tar.gz"
+          destination: "tenant"
+          extract: true
+`)
+	assert.NilError(t, err)
+	assert.NilError(t, c.Flush(context.Background()))
+
+	for file, expected := range files {
+		content, err := fs.ReadFile(destination, "tenant/"+file)
+		assert.NilError(t, err)
+		assert.Equal(t, expected, string(content))
+	}
+	// the archive must be read once when extracting, and once when flushing.
+	assert.Equal(t, 2, sourceFS.opens)
+}
+
+// openCountFS is a [fs.FS] which counts the opened files.
+type openCountFS struct {
+	fs.FS
+	opens int
+}
+
+func (f *openCountFS) Open(name string) (fs.File, error) {
+	f.opens++
+	return f.FS.Open(name)
+}
+
+func TestCopyFileExtractPathEscape(t *testing.T) {
+	_, err := resolveTestDataErr(t, `tables:
+  tenants:
+    rows:
+      - tenant_id: 987
+        assets:
+          !copyfile
+          source: "assets.zip"
+          destination: "tenant"
+          extract: true
+`,
+		WithSourceFS(fstest.MapFS{
+			"assets.zip": &fstest.MapFile{Data: testZipArchive(t, map[string]string{
+				"../../etc/passwd": "root",
+			})},
+		}),
+		WithDestination(NewMemoryDestination()))
+
+	var pathErr *PathEscapeError
+	assert.Assert(t, errors.As(err, &pathErr))
+	assert.Equal(t, "../../etc/passwd", pathErr.Path)
+	assert.ErrorIs(t, err, ErrPathEscapesRoot)
+}
+
+func testZipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		assert.NilError(t, err)
+		_, err = w.Write([]byte(content))
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func testTarArchive(t *testing.T, files map[string]string, compress bool) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var gw *gzip.Writer
+	tw := tar.NewWriter(&buf)
+	if compress {
+		gw = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gw)
+	}
+	for name, content := range files {
+		assert.NilError(t, tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+		}))
+		_, err := tw.Write([]byte(content))
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, tw.Close())
+	if gw != nil {
+		assert.NilError(t, gw.Close())
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,70 @@
+package copyfile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+)
+
+// isSHA256 returns whether str is a hex-encoded SHA-256.
+func isSHA256(str string) bool {
+	_, err := hex.DecodeString(str)
+	return err == nil && len(str) == sha256.Size*2
+}
+
+// checkSourceChecksum checks the SHA-256 of the source contents against the expected one in the file data, if set.
+func (c *CopyFile) checkSourceChecksum(info CopyFileInfo, sha string) error {
+	if info.FileData.SHA256 == "" || strings.EqualFold(info.FileData.SHA256, sha) {
+		return nil
+	}
+	return newChecksumError(info, info.Source, strings.ToLower(info.FileData.SHA256), sha)
+}
+
+// verifyDestinationFile re-reads the destination file and checks its SHA-256 against the written one.
+func (c *CopyFile) verifyDestinationFile(info CopyFileInfo, destination string, sha string) error {
+	file, err := c.destination.Open(destination)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	destinationSHA, err := hashSHA256(file)
+	if err != nil {
+		return err
+	}
+	if destinationSHA != sha {
+		return newChecksumError(info, info.Destination, sha, destinationSHA)
+	}
+	return nil
+}
+
+// sourceSHA256 returns the hex-encoded SHA-256 of the source file.
+func (c *CopyFile) sourceSHA256(info CopyFileInfo) (string, error) {
+	file, _, err := c.openFileSource(info)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return hashSHA256(file)
+}
+
+// hashSHA256 returns the hex-encoded SHA-256 of the reader contents.
+func hashSHA256(r io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func newChecksumError(info CopyFileInfo, path string, expected, actual string) error {
+	return &ChecksumError{
+		TableID:   info.TableID,
+		RowID:     info.RowID,
+		FieldName: info.FieldName,
+		Path:      path,
+		Expected:  expected,
+		Actual:    actual,
+	}
+}
@@ -0,0 +1,205 @@
+package copyfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCopyFileChecksum(t *testing.T) {
+	const (
+		imageSHA256 = "e08f3abcd2003925730d6317067d23616dc11313d1e5a82f6ff74692f6c304e6"
+		otherSHA256 = "0000000000000000000000000000000000000000000000000000000000000000"
+	)
+
+	for _, test := range []struct {
+		name        string
+		sha256      string
+		expectedErr bool
+	}{
+		{
+			name:   "match",
+			sha256: imageSHA256,
+		},
+		{
+			name:   "match uppercase",
+			sha256: "E08F3ABCD2003925730D6317067D23616DC11313D1E5A82F6FF74692F6C304E6",
+		},
+		{
+			name:        "mismatch",
+			sha256:      otherSHA256,
+			expectedErr: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			destination := NewMemoryDestination()
+
+			_, err := resolveTestDataErr(t, fmt.Sprintf(`tables:
+  tags:
+    rows:
+      - tag_id: 559
+        _refid: !refid "tag_javascript"
+        tagfilename:
+          !copyfile
+          source: "images/javascript.png"
+          destination: "images/{value:tag_id}.png"
+          sha256: "%s"
+`, test.sha256),
+				WithSourceFS(fstest.MapFS{
+					"images/javascript.png": &fstest.MapFile{Data: []byte("javascript image")},
+				}),
+				WithDestination(destination))
+
+			if !test.expectedErr {
+				assert.NilError(t, err)
+				return
+			}
+
+			var checksumErr *ChecksumError
+			assert.Assert(t, errors.As(err, &checksumErr))
+			assert.ErrorIs(t, err, ErrChecksumMismatch)
+			assert.Equal(t, "tags", checksumErr.TableID)
+			assert.Equal(t, "tag_javascript", checksumErr.RowID)
+			assert.Equal(t, "tagfilename", checksumErr.FieldName)
+			assert.Equal(t, "images/javascript.png", checksumErr.Path)
+			assert.Equal(t, otherSHA256, checksumErr.Expected)
+			assert.Equal(t, imageSHA256, checksumErr.Actual)
+
+			// the file must not be written.
+			_, err = destination.Stat("images/559.png")
+			assert.Assert(t, errors.Is(err, fs.ErrNotExist))
+		})
+	}
+}
+
+func TestCopyFileChecksumExistingDestination(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		overwrite OverwritePolicy
+		existing  string
+	}{
+		{
+			name:      "skip",
+			overwrite: OverwriteSkip,
+			existing:  "other image",
+		},
+		{
+			name:      "different but equal",
+			overwrite: OverwriteIfDifferent,
+			existing:  "javascript image",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			destination := NewMemoryDestination()
+			assert.NilError(t, destination.MkdirAll("images", 0o755))
+			f, err := destination.Create("images/559.png")
+			assert.NilError(t, err)
+			_, err = f.Write([]byte(test.existing))
+			assert.NilError(t, err)
+			assert.NilError(t, f.Close())
+
+			_, err = resolveTestDataErr(t, fmt.Sprintf(`tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tagfilename:
+          !copyfile
+          source: "images/javascript.png"
+          destination: "images/{value:tag_id}.png"
+          overwrite: "%s"
+          sha256: "0000000000000000000000000000000000000000000000000000000000000000"
+`, test.overwrite),
+				WithSourceFS(fstest.MapFS{
+					"images/javascript.png": &fstest.MapFile{Data: []byte("javascript image")},
+				}),
+				WithDestination(destination))
+			assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+			content, err := fs.ReadFile(destination, "images/559.png")
+			assert.NilError(t, err)
+			assert.Equal(t, test.existing, string(content))
+		})
+	}
+}
+
+func TestCopyFileVerifyDestination(t *testing.T) {
+	_, err := resolveTestDataErr(t, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tagfilename:
+          !copyfile
+          source: "images/javascript.png"
+          destination: "images/{value:tag_id}.png"
+`,
+		WithSourceFS(fstest.MapFS{
+			"images/javascript.png": &fstest.MapFile{Data: []byte("javascript image")},
+		}),
+		WithDestination(&corruptDestination{Destination: NewMemoryDestination()}),
+		WithVerifyDestination())
+
+	var checksumErr *ChecksumError
+	assert.Assert(t, errors.As(err, &checksumErr))
+	assert.Equal(t, "images/559.png", checksumErr.Path)
+}
+
+func TestCopyFileChecksumCopyFileCallback(t *testing.T) {
+	sourceFS := fstest.MapFS{
+		"images/javascript.png": &fstest.MapFile{Data: []byte("javascript image")},
+	}
+
+	called := false
+	_, err := resolveTestDataErr(t, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tagfilename:
+          !copyfile
+          source: "images/javascript.png"
+          destination: "images/{value:tag_id}.png"
+          sha256: "0000000000000000000000000000000000000000000000000000000000000000"
+`,
+		WithSourceFS(sourceFS),
+		WithCopyFileFSCallback(func(sourceFS fs.FS, sourceFilename string, destinationPath, destinationFilename string) error {
+			called = true
+			return nil
+		}))
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.Assert(t, !called)
+
+	destination := NewMemoryDestination()
+	_, err = resolveTestDataErr(t, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tagfilename:
+          !copyfile
+          source: "images/javascript.png"
+          destination: "images/{value:tag_id}.png"
+`,
+		WithSourceFS(sourceFS),
+		WithDestination(destination),
+		WithVerifyDestination(),
+		WithCopyFileFSCallback(func(sourceFS fs.FS, sourceFilename string, destinationPath, destinationFilename string) error {
+			writeTestFile(t, destination, destinationFilename, "other image")
+			return nil
+		}))
+	var checksumErr *ChecksumError
+	assert.Assert(t, errors.As(err, &checksumErr))
+	assert.Equal(t, "images/559.png", checksumErr.Path)
+}
+
+// corruptDestination is a Destination which returns different contents when reading files.
+type corruptDestination struct {
+	Destination
+}
+
+func (d *corruptDestination) Open(name string) (fs.File, error) {
+	return fstest.MapFS{
+		name: &fstest.MapFile{Data: []byte("corrupted")},
+	}.Open(name)
+}
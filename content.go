@@ -0,0 +1,92 @@
+package copyfile
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/rrgmc/debefix"
+)
+
+// ContentEncoding is the encoding of the inline file content.
+type ContentEncoding string
+
+const (
+	ContentText    ContentEncoding = "text"    // literal text, fields are replaced using ReplaceFieldsWithFilter.
+	ContentBase64  ContentEncoding = "base64"  // standard base64-encoded bytes.
+	ContentDataURI ContentEncoding = "datauri" // RFC 2397 data URI, like "data:text/plain;base64,SGVsbG8=".
+)
+
+// IsValid returns whether the encoding is a known one. A blank encoding is valid, and means ContentText.
+func (e ContentEncoding) IsValid() bool {
+	switch e {
+	case "", ContentText, ContentBase64, ContentDataURI:
+		return true
+	default:
+		return false
+	}
+}
+
+// resolveContent returns the decoded inline content of the file, or nil if it has no inline content.
+// If the file is a template, the source or the inline content is rendered as a template, and if it has a generator,
+// the generated content is returned.
+func (c *CopyFile) resolveContent(ctx debefix.ValueResolveContext, fieldname string, fileData FileData,
+	source string) ([]byte, error) {
+	if fileData.Generate != nil {
+		return c.generateContent(ctx, fieldname, fileData)
+	}
+	if fileData.Template {
+		return c.renderTemplate(ctx, fieldname, fileData, source)
+	}
+	if fileData.Content == nil {
+		return nil, nil
+	}
+	if fileData.Encoding == "" || fileData.Encoding == ContentText {
+		content, err := ReplaceFieldsWithFilter(*fileData.Content, ctx, WithReplaceFieldFuncs(c.fieldFuncs))
+		if err != nil {
+			return nil, err
+		}
+		return []byte(content), nil
+	}
+	return decodeContent(fileData)
+}
+
+// decodeContent returns the decoded inline content of the file, without replacing fields.
+func decodeContent(fileData FileData) ([]byte, error) {
+	if fileData.Content == nil {
+		return nil, nil
+	}
+
+	switch fileData.Encoding {
+	case "", ContentText:
+		return []byte(*fileData.Content), nil
+	case ContentBase64:
+		return base64.StdEncoding.DecodeString(strings.TrimSpace(*fileData.Content))
+	case ContentDataURI:
+		return decodeDataURI(strings.TrimSpace(*fileData.Content))
+	default:
+		return nil, fmt.Errorf("invalid content encoding '%s'", fileData.Encoding)
+	}
+}
+
+// decodeDataURI decodes the data of a RFC 2397 data URI, ignoring the media type.
+func decodeDataURI(uri string) ([]byte, error) {
+	data, ok := strings.CutPrefix(uri, "data:")
+	if !ok {
+		return nil, errors.New("invalid data URI: must start with 'data:'")
+	}
+	mediaType, data, ok := strings.Cut(data, ",")
+	if !ok {
+		return nil, errors.New("invalid data URI: missing ','")
+	}
+	if strings.HasSuffix(mediaType, ";base64") {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	decoded, err := url.PathUnescape(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data URI: %w", err)
+	}
+	return []byte(decoded), nil
+}
@@ -0,0 +1,120 @@
+package copyfile
+
+import (
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestContent(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		content  string
+		encoding ContentEncoding
+		expected string
+	}{
+		{
+			name:     "text",
+			content:  "id,name\\n{value:tag_id},{value:tag_name}\\n",
+			expected: "id,name\n559,javascript\n",
+		},
+		{
+			name:     "base64",
+			content:  "aW1hZ2UgZGF0YQ==",
+			encoding: ContentBase64,
+			expected: "image data",
+		},
+		{
+			name:     "data uri base64",
+			content:  "data:image/png;base64,aW1hZ2UgZGF0YQ==",
+			encoding: ContentDataURI,
+			expected: "image data",
+		},
+		{
+			name:     "data uri text",
+			content:  "data:text/plain,hello%20world",
+			encoding: ContentDataURI,
+			expected: "hello world",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			destination := NewMemoryDestination()
+
+			resolveTestData(t, fmt.Sprintf(`tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tag_name: "javascript"
+        tagfilename:
+          !copyfile
+          content: "%s"
+          encoding: "%s"
+          destination: "tags/{value:tag_id}.csv"
+`, test.content, test.encoding),
+				WithDestination(destination),
+			)
+
+			content, err := fs.ReadFile(destination, "tags/559.csv")
+			assert.NilError(t, err)
+			assert.Equal(t, test.expected, string(content))
+		})
+	}
+}
+
+func TestContentWithSource(t *testing.T) {
+	c := New(WithDestination(NewMemoryDestination()))
+	_, err := resolveTestCopyFile(t, c, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tagfilename:
+          !copyfile
+          content: "data"
+          source: "images/javascript.png"
+          destination: "tags/{value:tag_id}.csv"
+`)
+	assert.ErrorContains(t, err, "only one of source, content or generate can be set")
+}
+
+func TestContentWithCopyFileCallback(t *testing.T) {
+	destination := NewMemoryDestination()
+	called := false
+
+	resolveTestData(t, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tagfilename:
+          !copyfile
+          content: "image data"
+          destination: "tags/{value:tag_id}.txt"
+`,
+		WithDestination(destination),
+		WithCopyFileCallback(func(sourcePath, sourceFilename string, destinationPath, destinationFilename string) error {
+			called = true
+			return nil
+		}),
+	)
+
+	assert.Assert(t, !called)
+	content, err := fs.ReadFile(destination, "tags/559.txt")
+	assert.NilError(t, err)
+	assert.Equal(t, "image data", string(content))
+
+	_, err = resolveTestDataErr(t, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tagfilename:
+          !copyfile
+          content: "image data"
+          destination: "tags/{value:tag_id}.txt"
+`,
+		WithCopyFileCallback(func(sourcePath, sourceFilename string, destinationPath, destinationFilename string) error {
+			return nil
+		}),
+	)
+	assert.ErrorContains(t, err, "destination is required")
+}
@@ -0,0 +1,361 @@
+package copyfile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/rrgmc/debefix"
+)
+
+// CopyFileInfo is the information of a file to be copied.
+type CopyFileInfo struct {
+	TableID        string                      // debefix table ID.
+	RowID          string                      // row refid if set, or its internal ID.
+	FieldName      string                      // field name which contains the !copyfile tag.
+	FileData       FileData                    // data of the !copyfile tag.
+	Source         string                      // resolved source filename, relative to the source root.
+	Destination    string                      // resolved destination filename, relative to the destination root.
+	Content        []byte                      // resolved inline content, used instead of Source if not nil.
+	ResolveContext debefix.ValueResolveContext // debefix context of the resolved row.
+
+	archiveEntry *archiveEntry // position of the file in the source archive, read into Content by Flush.
+}
+
+// copyFile copies the file using the custom callback if set, or the default Copy otherwise.
+func (c *CopyFile) copyFile(ctx context.Context, info CopyFileInfo) error {
+	// [CopyFile.Copy] records detailed entries in the recorder, if it is called.
+	recorder := &manifestRecorder{}
+	ctx = context.WithValue(ctx, manifestRecorderKey{}, recorder)
+
+	start := time.Now()
+	var err error
+	if c.copyFileContextCallback != nil {
+		err = c.copyFileContextCallback(ctx, info)
+	} else {
+		err = c.Copy(ctx, info)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(recorder.entries) == 0 {
+		recorder.add(newManifestEntry(info, time.Since(start)))
+	}
+	c.addManifestEntries(recorder.entries...)
+	return nil
+}
+
+// context returns the context set by WithContext, or [context.Background] if not set.
+func (c *CopyFile) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// Copy is the default implementation of CopyFileContextCallback. It reads the source file from the source filesystem
+// or path, and writes it to the destination using the overwrite policy.
+func (c *CopyFile) Copy(ctx context.Context, info CopyFileInfo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.destination == nil {
+		return errors.New("destination is required")
+	}
+	if (info.Source == "" && info.Content == nil) || info.Destination == "" {
+		return errors.New("source and destination file names are required")
+	}
+
+	start := time.Now()
+	destination := fsPath(info.Destination)
+	entry := newManifestEntry(info, 0)
+
+	sourceFile, sourceSize, err := c.openFileSource(info)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	source, proceed, err := checkOverwrite(withContextReader(ctx, sourceFile), c.destination, destination,
+		c.getOverwritePolicy(info.FileData))
+	if err != nil {
+		return err
+	}
+
+	if !proceed && info.FileData.SHA256 != "" {
+		// the destination is kept, but the source must still match its expected checksum.
+		sha, err := c.sourceSHA256(info)
+		if err != nil {
+			return err
+		}
+		if err = c.checkSourceChecksum(info, sha); err != nil {
+			return err
+		}
+	}
+
+	mode, sha, linked := LinkCopy, "", false
+	if proceed {
+		mode, sha, linked, err = c.linkFile(info, destination)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !proceed {
+		entry.Skipped = true
+	} else if linked {
+		entry.Mode = mode
+		entry.Size = sourceSize
+		entry.SHA256 = sha
+	} else {
+		if err = c.destination.MkdirAll(path.Dir(destination), os.ModePerm); err != nil {
+			return err
+		}
+		result, err := writeFileAtomic(source, c.destination, destination, func(result writeResult) error {
+			return c.checkSourceChecksum(info, result.sha256)
+		})
+		if err != nil {
+			return err
+		}
+		entry.Mode = LinkCopy
+		entry.Size = result.size
+		entry.SHA256 = result.sha256
+	}
+
+	if !entry.Skipped && c.verifyDestination {
+		if err = c.verifyDestinationFile(info, destination, entry.SHA256); err != nil {
+			return err
+		}
+	}
+
+	entry.Duration = time.Since(start)
+	recordManifestEntry(ctx, entry)
+	return nil
+}
+
+// linkFile tries to create the destination file as a link to the source file using the link mode, returning false
+// if it was not possible, in which case the file must be copied.
+// If the file has an expected checksum or the destination must be verified, the source is hashed before linking,
+// and its hex-encoded SHA-256 is returned.
+func (c *CopyFile) linkFile(info CopyFileInfo, destination string) (mode LinkMode, sha string, linked bool, err error) {
+	mode = c.getLinkMode(info.FileData)
+	if mode == LinkCopy || c.sourceFS != nil || info.Content != nil {
+		return mode, "", false, nil
+	}
+	sourceFilename, err := filepath.Abs(filepath.Join(c.sourcePath, info.Source))
+	if err != nil {
+		return mode, "", false, nil
+	}
+	if info.FileData.SHA256 != "" || c.verifyDestination {
+		if sha, err = c.sourceSHA256(info); err != nil {
+			return mode, "", false, err
+		}
+		if err = c.checkSourceChecksum(info, sha); err != nil {
+			return mode, "", false, err
+		}
+	}
+	if err = linkDestinationFile(mode, sourceFilename, c.destination, destination); err != nil {
+		return mode, "", false, nil
+	}
+	return mode, sha, true, nil
+}
+
+// newManifestEntry creates a manifest entry without file details.
+func newManifestEntry(info CopyFileInfo, duration time.Duration) ManifestEntry {
+	return ManifestEntry{
+		TableID:     info.TableID,
+		RowID:       info.RowID,
+		FieldName:   info.FieldName,
+		FileID:      info.FileData.ID,
+		Source:      info.Source,
+		Destination: info.Destination,
+		Duration:    duration,
+	}
+}
+
+// legacyCopyFileCallback adapts CopyFileCallback and CopyFileFSCallback to CopyFileContextCallback.
+// It returns nil if no callback applies to the current source.
+// The callbacks only receive file names, so files with resolved contents, like inline, generated, template or
+// extracted archive files, are written by [CopyFile.Copy] instead.
+// The source checksum is checked and the overwrite policy applied before calling the callback, and the destination
+// is verified after it, if set. The callback is only called when the destination must be written.
+func (c *CopyFile) legacyCopyFileCallback() CopyFileContextCallback {
+	var callback CopyFileContextCallback
+	switch {
+	case c.sourceFS != nil && c.copyFileFSCallback != nil:
+		callback = func(ctx context.Context, info CopyFileInfo) error {
+			return c.copyFileFSCallback(c.sourceFS, info.Source, c.destinationPath, info.Destination)
+		}
+	case c.sourceFS == nil && c.copyFileCallback != nil:
+		callback = func(ctx context.Context, info CopyFileInfo) error {
+			return c.copyFileCallback(c.sourcePath, info.Source, c.destinationPath, info.Destination)
+		}
+	default:
+		return nil
+	}
+	return func(ctx context.Context, info CopyFileInfo) error {
+		if info.Content != nil {
+			return c.Copy(ctx, info)
+		}
+
+		var sha string
+		if info.FileData.SHA256 != "" || c.verifyDestination {
+			var err error
+			if sha, err = c.sourceSHA256(info); err != nil {
+				return err
+			}
+			if err = c.checkSourceChecksum(info, sha); err != nil {
+				return err
+			}
+		}
+
+		if proceed, err := c.checkLegacyOverwrite(ctx, info); err != nil {
+			return err
+		} else if !proceed {
+			entry := newManifestEntry(info, 0)
+			entry.Skipped = true
+			recordManifestEntry(ctx, entry)
+			return nil
+		}
+
+		if err := callback(ctx, info); err != nil {
+			return err
+		}
+
+		if c.verifyDestination {
+			if c.destination == nil {
+				return errors.New("destination is required to verify the copied file")
+			}
+			return c.verifyDestinationFile(info, fsPath(info.Destination), sha)
+		}
+		return nil
+	}
+}
+
+// checkLegacyOverwrite applies the overwrite policy for the legacy callbacks, returning whether the destination
+// must be written.
+func (c *CopyFile) checkLegacyOverwrite(ctx context.Context, info CopyFileInfo) (bool, error) {
+	policy := c.getOverwritePolicy(info.FileData)
+	if policy == OverwriteAlways {
+		return true, nil
+	}
+	if c.destination == nil {
+		return false, errors.New("destination is required to apply the overwrite policy")
+	}
+
+	var source io.Reader
+	if policy == OverwriteIfDifferent {
+		sourceFile, _, err := c.openFileSource(info)
+		if err != nil {
+			return false, err
+		}
+		defer sourceFile.Close()
+		source = withContextReader(ctx, sourceFile)
+	}
+	_, proceed, err := checkOverwrite(source, c.destination, fsPath(info.Destination), policy)
+	return proceed, err
+}
+
+// openFileSource opens the source contents of the file, either the inline content or the source file, returning
+// its size.
+func (c *CopyFile) openFileSource(info CopyFileInfo) (io.ReadCloser, int64, error) {
+	if info.Content != nil {
+		return &bytesReadCloser{Reader: bytes.NewReader(info.Content)}, int64(len(info.Content)), nil
+	}
+
+	file, err := c.openSource(info.Source)
+	if err != nil {
+		return nil, 0, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, 0, err
+	}
+	return file, stat.Size(), nil
+}
+
+// openSource opens a regular file from the source filesystem if set, or from the source path otherwise.
+func (c *CopyFile) openSource(source string) (fs.File, error) {
+	var file fs.File
+	var err error
+	if c.sourceFS != nil {
+		file, err = c.sourceFS.Open(fsPath(source))
+	} else if c.sourcePath != "" {
+		file, err = os.Open(filepath.Join(c.sourcePath, source))
+	} else {
+		return nil, errors.New("source path or filesystem is required")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if !stat.Mode().IsRegular() {
+		_ = file.Close()
+		return nil, fmt.Errorf("%s is not a regular file", source)
+	}
+	return file, nil
+}
+
+// getOverwritePolicy returns the overwrite policy of the file, or the global one if not set.
+func (c *CopyFile) getOverwritePolicy(fileData FileData) OverwritePolicy {
+	if fileData.Overwrite != "" {
+		return fileData.Overwrite
+	}
+	if c.overwritePolicy != "" {
+		return c.overwritePolicy
+	}
+	return OverwriteAlways
+}
+
+// withContextReader returns an [io.Reader] which stops reading when the context is done. If r is an
+// [io.ReadSeeker], the returned reader is also one.
+func withContextReader(ctx context.Context, r io.Reader) io.Reader {
+	if seeker, ok := r.(io.ReadSeeker); ok {
+		return &contextReadSeeker{contextReader: contextReader{ctx: ctx, r: r}, s: seeker}
+	}
+	return &contextReader{ctx: ctx, r: r}
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+type contextReadSeeker struct {
+	contextReader
+	s io.Seeker
+}
+
+func (r *contextReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return r.s.Seek(offset, whence)
+}
+
+// bytesReadCloser is a [bytes.Reader] with a no-op Close method.
+type bytesReadCloser struct {
+	*bytes.Reader
+}
+
+func (r *bytesReadCloser) Close() error {
+	return nil
+}
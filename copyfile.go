@@ -4,10 +4,23 @@ import "github.com/rrgmc/debefix"
 
 // New creates an instance of the CopyFile debefix plugin.
 func New(options ...Option) *CopyFile {
-	ret := &CopyFile{}
+	ret := &CopyFile{
+		sanitizePolicy:    DefaultSanitizePolicy,
+		sanitizeMaxLength: DefaultSanitizeMaxLength,
+	}
 	for _, opt := range options {
 		opt(ret)
 	}
+	if ret.copyFileContextCallback == nil {
+		ret.copyFileContextCallback = ret.legacyCopyFileCallback()
+	}
+	if ret.destination == nil && ret.destinationPath != "" {
+		ret.destination = NewOSDestination(ret.destinationPath)
+	}
+	if ret.isTransaction && ret.destination != nil {
+		ret.transaction = newTransactionDestination(ret.destination)
+		ret.destination = ret.transaction
+	}
 	return ret
 }
 
@@ -1,6 +1,11 @@
 package copyfile
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
 	"path/filepath"
 	"testing"
 	"testing/fstest"
@@ -303,3 +308,525 @@ func TestCopyFileMetadataDefault(t *testing.T) {
 	assert.Equal(t, "/tmp/source/images/tags/default.png", source)
 	assert.Equal(t, "/tmp/destination/tenant/Joomla/images/tags/559.png", destination)
 }
+
+func TestCopyFileSourceFS(t *testing.T) {
+	provider := debefix.NewFSFileProvider(fstest.MapFS{
+		"users.dbf.yaml": &fstest.MapFile{
+			Data: []byte(`tables:
+  tenants:
+    rows:
+      - tenant_id: 987
+        name: "Joomla"
+  tags:
+    config:
+      depends: ["tenants"]
+    rows:
+      - tag_id: 559
+        tenant_id: 987
+        tag_name: "javascript"
+        tagfilename:
+          !copyfile
+          value: "{value:tag_id}.png"
+          source: "images/tags/javascript.png"
+          destination: "tenant/{valueref:tenant_id:tenants:tenant_id:name}/images/tags/{value:tag_id}.png"
+`),
+		},
+	})
+
+	destinationPath := t.TempDir()
+
+	_, loadOptions, resolveOptions := NewOptions(
+		WithSourceFS(fstest.MapFS{
+			"images/tags/javascript.png": &fstest.MapFile{
+				Data: []byte("javascript image"),
+			},
+		}),
+		WithDestinationPath(destinationPath),
+	)
+
+	data, err := debefix.Load(provider, loadOptions...)
+	assert.NilError(t, err)
+
+	resolvedData, err := debefix.Resolve(data, func(ctx debefix.ResolveContext, fields map[string]any) error {
+		return nil
+	}, resolveOptions...)
+	assert.NilError(t, err)
+
+	assert.Equal(t, "559.png", resolvedData.Tables["tags"].Rows[0].Fields["tagfilename"])
+
+	content, err := os.ReadFile(filepath.Join(destinationPath, "tenant/Joomla/images/tags/559.png"))
+	assert.NilError(t, err)
+	assert.Equal(t, "javascript image", string(content))
+}
+
+func TestCopyFileDestination(t *testing.T) {
+	destination := NewMemoryDestination()
+
+	resolvedData := resolveTestData(t, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tag_name: "javascript"
+        tagfilename:
+          !copyfile
+          value: "{value:tag_id}.png"
+          source: "images/tags/{value:tag_name}.png"
+          destination: "images/tags/{value:tag_id}.png"
+`,
+		WithSourceFS(fstest.MapFS{
+			"images/tags/javascript.png": &fstest.MapFile{
+				Data: []byte("javascript image"),
+			},
+		}),
+		WithDestination(destination),
+	)
+
+	assert.Equal(t, "559.png", resolvedData.Tables["tags"].Rows[0].Fields["tagfilename"])
+
+	content, err := fs.ReadFile(destination, "images/tags/559.png")
+	assert.NilError(t, err)
+	assert.Equal(t, "javascript image", string(content))
+}
+
+func TestCopyFilePathEscape(t *testing.T) {
+	for _, test := range []struct {
+		name            string
+		source          string
+		destination     string
+		sourcePath      string
+		destinationPath string
+		options         []Option
+		expectedPath    string
+		expectedErr     error
+	}{
+		{
+			name:         "destination parent",
+			source:       "images/{value:tag_name}.png",
+			destination:  "tenant/{value:tenant_name}/{value:tag_id}.png",
+			options:      []Option{WithSanitizePolicy(SanitizeNone)},
+			expectedPath: "tenant/../../etc/559.png",
+			expectedErr:  ErrPathEscapesRoot,
+		},
+		{
+			name:         "source absolute",
+			source:       "/etc/passwd",
+			destination:  "{value:tag_id}.png",
+			expectedPath: "/etc/passwd",
+			expectedErr:  ErrPathEscapesRoot,
+		},
+		{
+			name:            "destination inside source",
+			source:          "images/{value:tag_name}.png",
+			destination:     "{value:tag_id}.png",
+			sourcePath:      "/tmp/source",
+			destinationPath: "/tmp/source/output",
+			expectedPath:    "559.png",
+			expectedErr:     ErrDestinationInsideSource,
+		},
+		{
+			name:        "allowed",
+			source:      "images/{value:tag_name}.png",
+			destination: "tenant/{value:tenant_name}/{value:tag_id}.png",
+			options:     []Option{WithAllowPathEscape()},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sourcePath := test.sourcePath
+			if sourcePath == "" {
+				sourcePath = "/tmp/source"
+			}
+			destinationPath := test.destinationPath
+			if destinationPath == "" {
+				destinationPath = "/tmp/destination"
+			}
+
+			copied := false
+
+			_, err := resolveTestDataErr(t, fmt.Sprintf(`tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tag_name: "javascript"
+        tenant_name: "../../etc"
+        _refid: !refid "tag_javascript"
+        tagfilename:
+          !copyfile
+          source: "%s"
+          destination: "%s"
+`, test.source, test.destination),
+				append([]Option{
+					WithSourcePath(sourcePath),
+					WithDestinationPath(destinationPath),
+					WithCopyFileCallback(func(sourcePath, sourceFilename string, destinationPath, destinationFilename string) error {
+						copied = true
+						return nil
+					}),
+				}, test.options...)...)
+			if test.expectedErr == nil {
+				assert.NilError(t, err)
+				assert.Assert(t, copied)
+				return
+			}
+
+			assert.ErrorIs(t, err, test.expectedErr)
+			var pathErr *PathEscapeError
+			assert.Assert(t, errors.As(err, &pathErr))
+			assert.Equal(t, "tags", pathErr.TableID)
+			assert.Equal(t, "tag_javascript", pathErr.RowID)
+			assert.Equal(t, "tagfilename", pathErr.FieldName)
+			assert.Equal(t, test.expectedPath, pathErr.Path)
+			assert.Assert(t, !copied)
+		})
+	}
+}
+
+func TestCopyFileOverwritePolicy(t *testing.T) {
+	for _, test := range []struct {
+		name            string
+		policy          OverwritePolicy
+		tagPolicy       OverwritePolicy
+		existing        string
+		expectedContent string
+		expectedErr     error
+	}{
+		{
+			name:            "default",
+			existing:        "old image",
+			expectedContent: "javascript image",
+		},
+		{
+			name:            "always",
+			policy:          OverwriteAlways,
+			existing:        "old image",
+			expectedContent: "javascript image",
+		},
+		{
+			name:        "error",
+			policy:      OverwriteError,
+			existing:    "old image",
+			expectedErr: ErrDestinationExists,
+		},
+		{
+			name:            "skip",
+			policy:          OverwriteSkip,
+			existing:        "old image",
+			expectedContent: "old image",
+		},
+		{
+			name:            "different",
+			policy:          OverwriteIfDifferent,
+			existing:        "old image",
+			expectedContent: "javascript image",
+		},
+		{
+			name:            "different equal",
+			policy:          OverwriteIfDifferent,
+			existing:        "javascript image",
+			expectedContent: "javascript image",
+		},
+		{
+			name:            "tag override",
+			policy:          OverwriteError,
+			tagPolicy:       OverwriteSkip,
+			existing:        "old image",
+			expectedContent: "old image",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			destination := NewMemoryDestination()
+			assert.NilError(t, destination.MkdirAll("images", 0o755))
+			f, err := destination.Create("images/559.png")
+			assert.NilError(t, err)
+			_, err = f.Write([]byte(test.existing))
+			assert.NilError(t, err)
+			assert.NilError(t, f.Close())
+			existingStat, err := destination.Stat("images/559.png")
+			assert.NilError(t, err)
+
+			_, err = resolveTestDataErr(t, fmt.Sprintf(`tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tag_name: "javascript"
+        tagfilename:
+          !copyfile
+          source: "images/{value:tag_name}.png"
+          destination: "images/{value:tag_id}.png"
+          overwrite: "%s"
+`, test.tagPolicy),
+				WithSourceFS(fstest.MapFS{
+					"images/javascript.png": &fstest.MapFile{
+						Data: []byte("javascript image"),
+					},
+				}),
+				WithDestination(destination),
+				WithOverwritePolicy(test.policy),
+			)
+			if test.expectedErr != nil {
+				assert.ErrorIs(t, err, test.expectedErr)
+				return
+			}
+			assert.NilError(t, err)
+
+			content, err := fs.ReadFile(destination, "images/559.png")
+			assert.NilError(t, err)
+			assert.Equal(t, test.expectedContent, string(content))
+
+			if test.existing == test.expectedContent {
+				stat, err := destination.Stat("images/559.png")
+				assert.NilError(t, err)
+				assert.Equal(t, existingStat.ModTime(), stat.ModTime())
+			}
+		})
+	}
+}
+
+func TestCopyFileOverwritePolicyCopyFileCallback(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		policy         OverwritePolicy
+		existing       string
+		expectedCalled bool
+		expectedErr    error
+	}{
+		{
+			name:           "always",
+			policy:         OverwriteAlways,
+			existing:       "old image",
+			expectedCalled: true,
+		},
+		{
+			name:        "error",
+			policy:      OverwriteError,
+			existing:    "old image",
+			expectedErr: ErrDestinationExists,
+		},
+		{
+			name:     "skip",
+			policy:   OverwriteSkip,
+			existing: "old image",
+		},
+		{
+			name:           "different",
+			policy:         OverwriteIfDifferent,
+			existing:       "old image",
+			expectedCalled: true,
+		},
+		{
+			name:     "different equal",
+			policy:   OverwriteIfDifferent,
+			existing: "javascript image",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			destination := NewMemoryDestination()
+			writeTestFile(t, destination, "images/559.png", test.existing)
+
+			called := false
+			_, err := resolveTestDataErr(t, fmt.Sprintf(`tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tagfilename:
+          !copyfile
+          source: "images/javascript.png"
+          destination: "images/{value:tag_id}.png"
+          overwrite: "%s"
+`, test.policy),
+				WithSourceFS(fstest.MapFS{
+					"images/javascript.png": &fstest.MapFile{Data: []byte("javascript image")},
+				}),
+				WithDestination(destination),
+				WithCopyFileFSCallback(func(sourceFS fs.FS, sourceFilename string, destinationPath, destinationFilename string) error {
+					called = true
+					return nil
+				}),
+			)
+			if test.expectedErr != nil {
+				assert.ErrorIs(t, err, test.expectedErr)
+			} else {
+				assert.NilError(t, err)
+			}
+			assert.Equal(t, test.expectedCalled, called)
+		})
+	}
+}
+
+func TestCopyFileContextCallback(t *testing.T) {
+	var infos []CopyFileInfo
+
+	resolveTestData(t, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tag_name: "javascript"
+        _refid: !refid "tag_javascript"
+        tagfilename:
+          !copyfile
+          source: "images/{value:tag_name}.png"
+          destination: "images/{value:tag_id}.png"
+`,
+		WithSourcePath("/tmp/source"),
+		WithDestinationPath("/tmp/destination"),
+		WithCopyFileCallback(func(sourcePath, sourceFilename string, destinationPath, destinationFilename string) error {
+			return errors.New("legacy callback should not be called")
+		}),
+		WithCopyFileContextCallback(func(ctx context.Context, info CopyFileInfo) error {
+			infos = append(infos, info)
+			return nil
+		}),
+	)
+
+	assert.Equal(t, 1, len(infos))
+	assert.Equal(t, "tags", infos[0].TableID)
+	assert.Equal(t, "tag_javascript", infos[0].RowID)
+	assert.Equal(t, "tagfilename", infos[0].FieldName)
+	assert.Equal(t, "images/{value:tag_name}.png", infos[0].FileData.Source)
+	assert.Equal(t, "images/javascript.png", infos[0].Source)
+	assert.Equal(t, "images/559.png", infos[0].Destination)
+	assert.Equal(t, uint64(559), infos[0].ResolveContext.Row().Fields["tag_id"])
+}
+
+func TestCopyFileContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	destination := NewMemoryDestination()
+
+	_, err := resolveTestDataErr(t, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tag_name: "javascript"
+        tagfilename:
+          !copyfile
+          source: "images/{value:tag_name}.png"
+          destination: "images/{value:tag_id}.png"
+`,
+		WithContext(ctx),
+		WithSourceFS(fstest.MapFS{
+			"images/javascript.png": &fstest.MapFile{
+				Data: []byte("javascript image"),
+			},
+		}),
+		WithDestination(destination),
+	)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = destination.Stat("images/559.png")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestCopyFileOptionalFields(t *testing.T) {
+	destination := NewMemoryDestination()
+	_ = resolveTestData(t, `tables:
+  tags:
+    config:
+      default_values:
+        tagfilename:
+          !copyfile
+          source: "images/{value:tag_name}.{value:ext:-png}"
+          destination: "images/{?{value:category}/}{value:tag_id}.{value:ext:-png}"
+    rows:
+      - tag_id: 559
+        tag_name: "javascript"
+      - tag_id: 560
+        tag_name: "golang"
+        category: "languages"
+        ext: "jpg"
+`,
+		WithSourceFS(fstest.MapFS{
+			"images/javascript.png": &fstest.MapFile{Data: []byte("javascript image")},
+			"images/golang.jpg":     &fstest.MapFile{Data: []byte("golang image")},
+		}),
+		WithDestination(destination))
+
+	content, err := fs.ReadFile(destination, "images/559.png")
+	assert.NilError(t, err)
+	assert.Equal(t, "javascript image", string(content))
+
+	content, err = fs.ReadFile(destination, "images/languages/560.jpg")
+	assert.NilError(t, err)
+	assert.Equal(t, "golang image", string(content))
+}
+
+func TestCopyFileInvalidFields(t *testing.T) {
+	_, err := resolveTestDataErr(t, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tagfilename:
+          !copyfile
+          source: "images/{value:tag_name.png"
+          destination: "images/{value:tag_id}.png"
+`, WithDestination(NewMemoryDestination()))
+	assert.ErrorIs(t, err, ErrUnclosedField)
+	assert.ErrorContains(t, err, "invalid source 'images/{value:tag_name.png': unclosed field at offset 7")
+}
+
+func TestCopyFileSanitize(t *testing.T) {
+	data := `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tenant_name: "a/b:c.."
+        tagfilename:
+          !copyfile
+          source: "images/javascript.png"
+          destination: "tenant/{value:tenant_name}/{value:tag_id}.png"
+          value: "{value:tenant_name}/{value:tag_id}.png"
+`
+	sourceFS := fstest.MapFS{
+		"images/javascript.png": &fstest.MapFile{Data: []byte("javascript image")},
+	}
+
+	destination := NewMemoryDestination()
+	resolvedData := resolveTestData(t, data, WithSourceFS(sourceFS), WithDestination(destination))
+	assert.Equal(t, "a/b:c../559.png", resolvedData.Tables["tags"].Rows[0].Fields["tagfilename"])
+	content, err := fs.ReadFile(destination, "tenant/a%2Fb%3Ac%2E%2E/559.png")
+	assert.NilError(t, err)
+	assert.Equal(t, "javascript image", string(content))
+
+	destination = NewMemoryDestination()
+	_ = resolveTestData(t, data, WithSourceFS(sourceFS), WithDestination(destination),
+		WithSanitizePolicy(SanitizeReplace))
+	_, err = fs.ReadFile(destination, "tenant/a_b_c__/559.png")
+	assert.NilError(t, err)
+
+	_, err = resolveTestDataErr(t, data, WithSourceFS(sourceFS), WithDestination(NewMemoryDestination()),
+		WithSanitizePolicy(SanitizeReject))
+	assert.ErrorIs(t, err, ErrUnsafePathValue)
+}
+
+// resolveTestData loads and resolves the YAML data using the plugin with the passed options.
+func resolveTestData(t *testing.T, data string, options ...Option) *debefix.Data {
+	t.Helper()
+
+	resolvedData, err := resolveTestDataErr(t, data, options...)
+	assert.NilError(t, err)
+	return resolvedData
+}
+
+// resolveTestDataErr loads and resolves the YAML data using the plugin with the passed options, returning the
+// resolve error.
+func resolveTestDataErr(t *testing.T, data string, options ...Option) (*debefix.Data, error) {
+	t.Helper()
+	return resolveTestCopyFile(t, New(options...), data)
+}
+
+// resolveTestCopyFile loads and resolves the YAML data using the plugin instance, returning the load or resolve
+// error.
+func resolveTestCopyFile(t *testing.T, c *CopyFile, data string) (*debefix.Data, error) {
+	t.Helper()
+
+	loadedData, err := debefix.Load(debefix.NewFSFileProvider(fstest.MapFS{
+		"data.dbf.yaml": &fstest.MapFile{Data: []byte(data)},
+	}), debefix.WithLoadValueParser(c))
+	if err != nil {
+		return nil, err
+	}
+
+	return debefix.Resolve(loadedData, func(ctx debefix.ResolveContext, fields map[string]any) error {
+		return nil
+	}, debefix.WithRowResolvedCallback(c))
+}
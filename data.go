@@ -1,9 +1,68 @@
 package copyfile
 
 // FileData is the information of the !copyfile tag.
+// Source can be a single file, a directory which is copied recursively, or a glob pattern like
+// "themes/dark/**/*.css". For directories and globs, Destination is the destination directory.
 type FileData struct {
 	ID          string  `yaml:"id"`
 	Value       *string `yaml:"value"`
 	Source      string  `yaml:"source"`
 	Destination string  `yaml:"destination"`
+
+	// Files is a list of files copied for the same field, used instead of Source, Content or Generate. Each entry
+	// has its own ID, Source and Destination, and inherits Overwrite and Mode from the tag if not set.
+	Files []FileData `yaml:"files"`
+	// ValueFrom selects the ID of the Files entry whose Value is used as the field value, if Value is not set.
+	// If neither is set, the field value is the list of the values of the entries which set one.
+	ValueFrom string `yaml:"value_from"`
+
+	// Extract extracts the Source archive into the Destination directory. The archive format is detected from the
+	// Source extension, or can be set using Format, which also implies Extract.
+	Extract bool          `yaml:"extract"`
+	Format  ArchiveFormat `yaml:"format"`
+	// Subpath extracts only the archive files inside this directory, relative to it.
+	Subpath string `yaml:"subpath"`
+
+	// Include and Exclude filter the files copied when Source is a directory, a glob pattern or an archive, and are
+	// matched against the file path relative to the directory. Patterns support "**" to match any number of directories.
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+
+	// Content is the inline file content, used instead of Source.
+	Content *string `yaml:"content"`
+	// Encoding is the encoding of Content. The default is ContentText.
+	Encoding ContentEncoding `yaml:"encoding"`
+	// Template renders the source file or the inline content as a Go [text/template], using [TemplateData].
+	Template bool `yaml:"template"`
+	// Generate generates the file content using a [Generator], used instead of Source. The "name" parameter selects
+	// the generator, the other parameters are passed to it.
+	Generate map[string]any `yaml:"generate"`
+
+	// SHA256 is the expected hex-encoded SHA-256 of the file contents. The copy fails with a [ChecksumError] if the
+	// copied contents don't match. It can only be set for single files.
+	SHA256 string `yaml:"sha256"`
+
+	// Overwrite overrides the global overwrite policy for this file.
+	Overwrite OverwritePolicy `yaml:"overwrite"`
+
+	// Mode overrides the global link mode for this file.
+	Mode LinkMode `yaml:"mode"`
+}
+
+// fileEntries returns the list of files to copy for the tag, which is the tag itself if Files is not set.
+func (f FileData) fileEntries() []FileData {
+	if len(f.Files) == 0 {
+		return []FileData{f}
+	}
+	ret := make([]FileData, 0, len(f.Files))
+	for _, entry := range f.Files {
+		if entry.Overwrite == "" {
+			entry.Overwrite = f.Overwrite
+		}
+		if entry.Mode == "" {
+			entry.Mode = f.Mode
+		}
+		ret = append(ret, entry)
+	}
+	return ret
 }
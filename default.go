@@ -2,48 +2,106 @@ package copyfile
 
 import (
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/rrgmc/debefix"
 )
 
 // ReplaceFieldsWithFilter replaces curly-braces separated fields in str as debefix filter expressions.
-func ReplaceFieldsWithFilter(str string, ctx debefix.ValueResolveContext) (string, error) {
+// When called from the callbacks of this plugin, "file:" (size, sha256, md5, mimetype, width, height) and "source:"
+// (basename, dir, ext, stem) fields are replaced with the attributes of the source file, and the functions registered
+// with WithFieldFunc can be used in field pipes.
+func ReplaceFieldsWithFilter(str string, ctx debefix.ValueResolveContext, options ...ReplaceOption) (string, error) {
 	p := ParseFields(str)
 	if len(p.Fields()) == 0 {
-		return str, nil
+		// collapse escapes.
+		return p.Replace(nil)
+	}
+
+	actx, isPluginContext := ctx.(fileAttributesContext)
+	if isPluginContext {
+		options = append([]ReplaceOption{WithReplaceFieldFuncs(actx.fileAttributes().c.fieldFuncs)}, options...)
+	}
+
+	// optional fields which can't be extracted are left missing, so their default value is used.
+	optional := map[string]bool{}
+	for _, fld := range p.OptionalFields() {
+		optional[fld] = true
 	}
 
 	rmap := map[string]string{}
+	extraValues := map[string]any{}
+	trusted := map[string]bool{}
 	for _, fld := range p.Fields() {
-		rmap[fld] = fld
+		var value any
+		var err error
+		switch {
+		case isPluginContext && isFileAttributeField(fld):
+			// file attributes are never sanitized, as "source:dir" is a path.
+			trusted[fld] = true
+			value, err = actx.fileAttributes().value(fld)
+		case optional[fld]:
+			value, err = ctx.ResolvedData().ExtractValue(ctx.Row(), fld)
+		default:
+			rmap[fld] = fld
+			continue
+		}
+		if err != nil {
+			if optional[fld] {
+				continue
+			}
+			return "", err
+		}
+		extraValues[fld] = value
 	}
 
 	replaceValues, err := ctx.ResolvedData().ExtractValues(ctx.Row(), rmap)
 	if err != nil {
 		return "", err
 	}
+	for fld, value := range extraValues {
+		replaceValues[fld] = value
+	}
 
-	return p.Replace(replaceValues)
+	return p.Replace(replaceValues, append(options, withReplaceTrustedFields(trusted))...)
 }
 
 // DefaultGetPathsCallback is the default implementation of GetPathsCallback.
+// The values substituted into the paths are sanitized using the policy set with WithSanitizePolicy, or
+// DefaultSanitizePolicy if not called from the plugin callbacks.
 func DefaultGetPathsCallback(ctx debefix.ValueResolveContext, fieldname string, fileData FileData) (source string, destination string, err error) {
-	source, err = ReplaceFieldsWithFilter(fileData.Source, ctx)
+	sanitize := pathSanitizeOption(ctx)
+	source, err = ReplaceFieldsWithFilter(fileData.Source, ctx, sanitize)
 	if err != nil {
 		return "", "", err
 	}
-	destination, err = ReplaceFieldsWithFilter(fileData.Destination, ctx)
+	destination, err = ReplaceFieldsWithFilter(fileData.Destination, ctx, sanitize)
 	if err != nil {
 		return "", "", err
 	}
 	return source, destination, nil
 }
 
+// pathSanitizeOption returns the option to sanitize the values substituted into path templates.
+func pathSanitizeOption(ctx debefix.ValueResolveContext) ReplaceOption {
+	if actx, ok := ctx.(fileAttributesContext); ok {
+		c := actx.fileAttributes().c
+		return WithReplaceSanitize(c.sanitizePolicy, c.sanitizeMaxLength)
+	}
+	return WithReplaceSanitize(DefaultSanitizePolicy, DefaultSanitizeMaxLength)
+}
+
 // DefaultGetValueCallback is the default implementation of GetValueCallback.
+// If the tag has a list of files and doesn't set Value, the value of the ValueFrom entry is returned, or the list of
+// the values of all entries which set one.
 func DefaultGetValueCallback(ctx debefix.ValueCallbackResolveContext, fileData FileData) (value any, addField bool, err error) {
+	if fileData.Value == nil && len(fileData.Files) > 0 {
+		return getFilesValue(ctx, fileData)
+	}
 	if fileData.Value == nil {
 		return nil, false, nil
 	}
@@ -54,6 +112,36 @@ func DefaultGetValueCallback(ctx debefix.ValueCallbackResolveContext, fileData F
 	return sv, true, nil
 }
 
+// getFilesValue returns the value of a tag with a list of files.
+func getFilesValue(ctx debefix.ValueCallbackResolveContext, fileData FileData) (value any, addField bool, err error) {
+	var values []any
+	for _, entry := range fileData.Files {
+		if fileData.ValueFrom != "" && entry.ID != fileData.ValueFrom {
+			continue
+		}
+		entryCtx := ctx
+		if fctx, ok := ctx.(*fileValueCallbackResolveContext); ok {
+			// provide the attributes of the entry file.
+			entryCtx = fctx.withFileData(entry)
+		}
+		ev, add, err := DefaultGetValueCallback(entryCtx, entry)
+		if err != nil {
+			return nil, false, err
+		}
+		if !add {
+			continue
+		}
+		if fileData.ValueFrom != "" {
+			return ev, true, nil
+		}
+		values = append(values, ev)
+	}
+	if len(values) == 0 {
+		return nil, false, nil
+	}
+	return values, true, nil
+}
+
 // DefaultCopyFileCallback is the default implementation of CopyFileCallback.
 func DefaultCopyFileCallback(sourcePath, sourceFilename string, destinationPath, destinationFilename string) error {
 	if sourcePath == "" || destinationPath == "" {
@@ -78,19 +166,41 @@ func DefaultCopyFileCallback(sourcePath, sourceFilename string, destinationPath,
 	}
 	defer source.Close()
 
-	destinationFullFilename := filepath.Join(destinationPath, destinationFilename)
+	_, err = writeDestinationFile(source, NewOSDestination(destinationPath), fsPath(destinationFilename), OverwriteAlways)
+	return err
+}
+
+// DefaultCopyFileFSCallback is the default implementation of CopyFileFSCallback.
+func DefaultCopyFileFSCallback(sourceFS fs.FS, sourceFilename string, destinationPath, destinationFilename string) error {
+	if sourceFS == nil || destinationPath == "" {
+		return fmt.Errorf("source filesystem and destination path are required")
+	}
+	if sourceFilename == "" || destinationFilename == "" {
+		return fmt.Errorf("source and destination file names are required")
+	}
+
+	sourceFilename = fsPath(sourceFilename)
 
-	err = os.MkdirAll(filepath.Dir(destinationFullFilename), os.ModePerm)
+	sourceFileStat, err := fs.Stat(sourceFS, sourceFilename)
 	if err != nil {
 		return err
 	}
 
-	destination, err := os.Create(destinationFullFilename)
+	if !sourceFileStat.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", sourceFilename)
+	}
+
+	source, err := sourceFS.Open(sourceFilename)
 	if err != nil {
 		return err
 	}
-	defer destination.Close()
-	_, err = io.Copy(destination, source)
+	defer source.Close()
 
+	_, err = writeDestinationFile(source, NewOSDestination(destinationPath), fsPath(destinationFilename), OverwriteAlways)
 	return err
 }
+
+// fsPath converts a filename to the slash-separated, unrooted format required by [fs.FS].
+func fsPath(filename string) string {
+	return strings.TrimPrefix(path.Clean(filepath.ToSlash(filename)), "/")
+}
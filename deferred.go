@@ -0,0 +1,109 @@
+package copyfile
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// Flush executes the file copies queued in deferred mode, returning all errors joined.
+// In transaction mode, the written files are rolled back if any copy fails.
+// It is a no-op if not in deferred mode.
+func (c *CopyFile) Flush(ctx context.Context) error {
+	queue := c.clearQueue()
+	if len(queue) == 0 {
+		return nil
+	}
+
+	workers := c.workers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	workers = min(workers, len(queue))
+
+	jobs := make(chan CopyFileInfo)
+	var errsMutex sync.Mutex
+	var errs []error
+	addError := func(err error) {
+		errsMutex.Lock()
+		errs = append(errs, err)
+		errsMutex.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for info := range jobs {
+				if err := c.copyFile(ctx, info); err != nil {
+					addError(err)
+				}
+			}
+		}()
+	}
+
+	// archive entries are read sequentially, once per archive, after the other files are queued.
+	var archives []archiveEntries
+	archiveIndex := map[archiveEntries]int{}
+	var entries []map[int][]CopyFileInfo
+	for _, info := range queue {
+		if info.archiveEntry == nil {
+			jobs <- info
+			continue
+		}
+		archive := archiveEntries{source: info.archiveEntry.source, format: info.archiveEntry.format}
+		idx, ok := archiveIndex[archive]
+		if !ok {
+			idx = len(archives)
+			archiveIndex[archive] = idx
+			archives = append(archives, archive)
+			entries = append(entries, map[int][]CopyFileInfo{})
+		}
+		entries[idx][info.archiveEntry.index] = append(entries[idx][info.archiveEntry.index], info)
+	}
+	for idx, archive := range archives {
+		err := c.readArchiveEntries(ctx, archive, entries[idx], func(info CopyFileInfo) {
+			jobs <- info
+		})
+		if err != nil {
+			addError(err)
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return errors.Join(err, c.Rollback())
+	}
+	return nil
+}
+
+// enqueueCopy adds the file copy to the queue, replacing any queued copy with the same destination.
+func (c *CopyFile) enqueueCopy(info CopyFileInfo) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	destination := fsPath(info.Destination)
+	if idx, ok := c.queueIndex[destination]; ok {
+		c.queue[idx] = info
+		return
+	}
+	if c.queueIndex == nil {
+		c.queueIndex = map[string]int{}
+	}
+	c.queueIndex[destination] = len(c.queue)
+	c.queue = append(c.queue, info)
+}
+
+// clearQueue clears the queue, returning the queued copies.
+func (c *CopyFile) clearQueue() []CopyFileInfo {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	queue := c.queue
+	c.queue = nil
+	c.queueIndex = nil
+	return queue
+}
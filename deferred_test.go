@@ -0,0 +1,105 @@
+package copyfile
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/rrgmc/debefix"
+	"gotest.tools/v3/assert"
+)
+
+func TestDeferred(t *testing.T) {
+	var data strings.Builder
+	data.WriteString(`tables:
+  tags:
+    config:
+      default_values:
+        tagfilename:
+          !copyfile
+          source: "images/{value:tag_name}.png"
+          destination: "images/{value:tag_id}.png"
+    rows:
+`)
+	for i := range 20 {
+		_, _ = fmt.Fprintf(&data, "      - tag_id: %d\n        tag_name: \"javascript\"\n", i)
+	}
+	// duplicated destination, only the last one must be copied.
+	data.WriteString("      - tag_id: 5\n        tag_name: \"golang\"\n")
+
+	destination := NewMemoryDestination()
+
+	c := New(
+		WithSourceFS(fstest.MapFS{
+			"images/javascript.png": &fstest.MapFile{Data: []byte("javascript image")},
+			"images/golang.png":     &fstest.MapFile{Data: []byte("golang image")},
+		}),
+		WithDestination(destination),
+		WithDeferred(4),
+	)
+
+	_, err := resolveTestCopyFile(t, c, data.String())
+	assert.NilError(t, err)
+
+	_, err = destination.Stat("images")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	assert.NilError(t, c.Flush(context.Background()))
+
+	entries, err := fs.ReadDir(destination, "images")
+	assert.NilError(t, err)
+	assert.Equal(t, 20, len(entries))
+	assert.Equal(t, 20, len(c.Manifest()))
+
+	content, err := fs.ReadFile(destination, "images/5.png")
+	assert.NilError(t, err)
+	assert.Equal(t, "golang image", string(content))
+
+	// nothing left to flush.
+	assert.NilError(t, c.Flush(context.Background()))
+	assert.Equal(t, 20, len(c.Manifest()))
+}
+
+func TestDeferredResolve(t *testing.T) {
+	destination := NewMemoryDestination()
+
+	c := New(
+		WithSourceFS(fstest.MapFS{
+			"images/javascript.png": &fstest.MapFile{Data: []byte("javascript image")},
+		}),
+		WithDestination(destination),
+		WithDeferred(0),
+	)
+
+	data, err := debefix.Load(debefix.NewFSFileProvider(fstest.MapFS{
+		"data.dbf.yaml": &fstest.MapFile{Data: []byte(`tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tag_name: "javascript"
+        tagfilename:
+          !copyfile
+          source: "images/{value:tag_name}.png"
+          destination: "images/{value:tag_id}.png"
+      - tag_id: 560
+        tag_name: "golang"
+        tagfilename:
+          !copyfile
+          source: "images/{value:tag_name}.png"
+          destination: "images/{value:tag_id}.png"
+`)},
+	}), debefix.WithLoadValueParser(c))
+	assert.NilError(t, err)
+
+	_, err = c.Resolve(data, func(ctx debefix.ResolveContext, fields map[string]any) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	content, err := fs.ReadFile(destination, "images/559.png")
+	assert.NilError(t, err)
+	assert.Equal(t, "javascript image", string(content))
+}
@@ -0,0 +1,176 @@
+package copyfile
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Destination is a writable filesystem where files are copied to.
+// All names are slash-separated paths relative to the destination root, the same format used by [fs.FS].
+// The [fs.FS] implementation allows reading back the written files.
+type Destination interface {
+	fs.FS
+	// MkdirAll creates a directory named name, along with any necessary parents.
+	MkdirAll(name string, perm fs.FileMode) error
+	// Create creates or truncates the named file, opening it for writing.
+	Create(name string) (DestinationFile, error)
+	// CreateTemp creates a new file in the directory dir, opening it for writing. The filename is generated by
+	// taking pattern and replacing the last "*" with a random string, like [os.CreateTemp].
+	CreateTemp(dir, pattern string) (DestinationFile, error)
+	// Stat returns a [fs.FileInfo] describing the named file.
+	Stat(name string) (fs.FileInfo, error)
+	// Remove removes the named file or empty directory.
+	Remove(name string) error
+	// Rename renames (moves) oldname to newname, replacing newname if it already exists.
+	Rename(oldname, newname string) error
+}
+
+// DestinationFile is a file opened for writing by [Destination].
+type DestinationFile interface {
+	io.WriteCloser
+	// Name returns the name of the file, relative to the destination root.
+	Name() string
+	// Sync commits the written contents to stable storage.
+	Sync() error
+}
+
+// LinkDestination is a [Destination] which supports creating links to files in the OS filesystem.
+// The methods must return an error wrapping [errors.ErrUnsupported] if the link type is not supported.
+type LinkDestination interface {
+	Destination
+	// Symlink creates newname as a symbolic link to the OS file oldname.
+	Symlink(oldname, newname string) error
+	// Link creates newname as a hard link to the OS file oldname.
+	Link(oldname, newname string) error
+	// Reflink creates newname as a copy-on-write clone of the OS file oldname.
+	Reflink(oldname, newname string) error
+}
+
+// NewOSDestination creates a [Destination] that writes files in the OS filesystem, rooted at rootDir.
+func NewOSDestination(rootDir string) Destination {
+	return &osDestination{
+		rootDir: rootDir,
+		fs:      os.DirFS(rootDir),
+	}
+}
+
+type osDestination struct {
+	rootDir string
+	fs      fs.FS
+}
+
+var (
+	_ LinkDestination = (*osDestination)(nil)
+	_ localLinker     = (*osDestination)(nil)
+)
+
+func (d *osDestination) Open(name string) (fs.File, error) {
+	return d.fs.Open(name)
+}
+
+func (d *osDestination) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(d.path(name), perm)
+}
+
+func (d *osDestination) Create(name string) (DestinationFile, error) {
+	file, err := os.Create(d.path(name))
+	if err != nil {
+		return nil, err
+	}
+	return &osDestinationFile{File: file, name: name}, nil
+}
+
+func (d *osDestination) CreateTemp(dir, pattern string) (DestinationFile, error) {
+	return createTemp(dir, pattern, func(name string) (DestinationFile, error) {
+		file, err := os.OpenFile(d.path(name), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
+		if err != nil {
+			return nil, err
+		}
+		return &osDestinationFile{File: file, name: name}, nil
+	})
+}
+
+func (d *osDestination) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(d.path(name))
+}
+
+func (d *osDestination) Remove(name string) error {
+	return os.Remove(d.path(name))
+}
+
+func (d *osDestination) Rename(oldname, newname string) error {
+	err := os.Rename(d.path(oldname), d.path(newname))
+	if err != nil {
+		return err
+	}
+	// make the rename durable.
+	return syncDir(filepath.Dir(d.path(newname)))
+}
+
+func (d *osDestination) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, d.path(newname))
+}
+
+func (d *osDestination) Link(oldname, newname string) error {
+	return os.Link(oldname, d.path(newname))
+}
+
+func (d *osDestination) Reflink(oldname, newname string) error {
+	return reflink(oldname, d.path(newname))
+}
+
+func (d *osDestination) linkLocal(oldname, newname string) error {
+	return os.Link(d.path(oldname), d.path(newname))
+}
+
+func (d *osDestination) path(name string) string {
+	return filepath.Join(d.rootDir, filepath.FromSlash(name))
+}
+
+type osDestinationFile struct {
+	*os.File
+	name string
+}
+
+func (f *osDestinationFile) Name() string {
+	return f.name
+}
+
+// createTemp creates a temporary file using the create function, which must fail with [fs.ErrExist] if the file
+// already exists.
+func createTemp(dir, pattern string, create func(name string) (DestinationFile, error)) (DestinationFile, error) {
+	var file DestinationFile
+	_, err := tryTempName(dir, pattern, func(name string) (err error) {
+		file, err = create(name)
+		return err
+	})
+	return file, err
+}
+
+// tryTempName calls the create function with random names generated from pattern, until it doesn't fail with
+// [fs.ErrExist]. The last "*" in pattern is replaced by the random string, like [os.CreateTemp].
+func tryTempName(dir, pattern string, create func(name string) error) (string, error) {
+	if strings.Contains(pattern, "/") {
+		return "", &fs.PathError{Op: "createtemp", Path: pattern, Err: errors.New("pattern contains path separator")}
+	}
+	prefix, suffix := pattern, ""
+	if pos := strings.LastIndex(pattern, "*"); pos != -1 {
+		prefix, suffix = pattern[:pos], pattern[pos+1:]
+	}
+
+	for try := 0; ; try++ {
+		name := path.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10)+suffix)
+		err := create(name)
+		if errors.Is(err, fs.ErrExist) && try < 10000 {
+			continue
+		}
+		return name, err
+	}
+}
@@ -0,0 +1,172 @@
+package copyfile
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"time"
+
+	"golang.org/x/exp/maps"
+)
+
+// ArchiveDestination is a [Destination] which bundles all written files into a single archive.
+// The files are kept in memory, and the archive is written when Close is called.
+type ArchiveDestination interface {
+	Destination
+	// Close writes the archive with all files in the destination. The destination must not be used after it.
+	Close() error
+}
+
+// archiveModTime is the modification time of all archive entries, so the output is reproducible.
+// It is the minimum time supported by the zip format.
+var archiveModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// NewArchiveDestination creates an [ArchiveDestination] which writes the archive to w on Close.
+// Paths inside the archive are the destination paths, sorted by name.
+func NewArchiveDestination(w io.Writer, format ArchiveFormat) ArchiveDestination {
+	return &archiveDestination{
+		memoryDestination: newMemoryDestination(),
+		format:            format,
+		open: func() (io.WriteCloser, error) {
+			return nopWriteCloser{Writer: w}, nil
+		},
+	}
+}
+
+// NewArchiveFileDestination creates an [ArchiveDestination] which writes the archive to the OS file filename on
+// Close. If format is blank, it is detected from the filename extension.
+func NewArchiveFileDestination(filename string, format ArchiveFormat) ArchiveDestination {
+	return &archiveDestination{
+		memoryDestination: newMemoryDestination(),
+		format:            format,
+		filename:          filename,
+		open: func() (io.WriteCloser, error) {
+			return os.Create(filename)
+		},
+	}
+}
+
+type archiveDestination struct {
+	*memoryDestination
+	format   ArchiveFormat
+	filename string
+	open     func() (io.WriteCloser, error)
+	closed   bool
+}
+
+var _ ArchiveDestination = (*archiveDestination)(nil)
+
+func (d *archiveDestination) Close() error {
+	if d.closed {
+		return fs.ErrClosed
+	}
+	d.closed = true
+
+	format := d.format
+	if format == "" {
+		var err error
+		if format, err = archiveFormat(FileData{}, d.filename); err != nil {
+			return err
+		}
+	}
+
+	w, err := d.open()
+	if err != nil {
+		return err
+	}
+	err = d.writeArchive(w, format)
+	return errors.Join(err, w.Close())
+}
+
+// writeArchive writes all files and directories to the archive, sorted by name.
+func (d *archiveDestination) writeArchive(w io.Writer, format ArchiveFormat) error {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	names := maps.Keys(d.files)
+	slices.Sort(names)
+	names = slices.DeleteFunc(names, func(name string) bool {
+		return name == "."
+	})
+
+	switch format {
+	case ArchiveZip:
+		zw := zip.NewWriter(w)
+		for _, name := range names {
+			if err := d.writeZipEntry(zw, name, d.files[name]); err != nil {
+				return err
+			}
+		}
+		return zw.Close()
+	case ArchiveTarGz:
+		gw := gzip.NewWriter(w)
+		if err := d.writeTar(gw, names); err != nil {
+			return err
+		}
+		return gw.Close()
+	case ArchiveTar:
+		return d.writeTar(w, names)
+	default:
+		return fmt.Errorf("invalid archive format '%s'", format)
+	}
+}
+
+func (d *archiveDestination) writeZipEntry(zw *zip.Writer, name string, file *memoryFile) error {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: archiveModTime,
+	}
+	if file.mode.IsDir() {
+		header.Name += "/"
+		header.Method = zip.Store
+		header.SetMode(fs.ModeDir | 0o755)
+	} else {
+		header.SetMode(0o644)
+	}
+	fw, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(file.data)
+	return err
+}
+
+func (d *archiveDestination) writeTar(w io.Writer, names []string) error {
+	tw := tar.NewWriter(w)
+	for _, name := range names {
+		file := d.files[name]
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(file.data)),
+			ModTime:  archiveModTime,
+		}
+		if file.mode.IsDir() {
+			header.Typeflag = tar.TypeDir
+			header.Name = name + "/"
+			header.Mode = 0o755
+			header.Size = 0
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,90 @@
+package copyfile
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestArchiveDestination(t *testing.T) {
+	for _, format := range []ArchiveFormat{ArchiveZip, ArchiveTar, ArchiveTarGz} {
+		t.Run(string(format), func(t *testing.T) {
+			resolveArchive := func() []byte {
+				var buf bytes.Buffer
+				destination := NewArchiveDestination(&buf, format)
+				_ = resolveTestData(t, `tables:
+  tags:
+    config:
+      default_values:
+        tagfilename:
+          !copyfile
+          source: "images/{value:tag_name}.png"
+          destination: "images/{value:tag_id}.png"
+    rows:
+      - tag_id: 560
+        tag_name: "golang"
+      - tag_id: 559
+        tag_name: "javascript"
+`,
+					WithSourceFS(fstest.MapFS{
+						"images/javascript.png": &fstest.MapFile{Data: []byte("javascript image")},
+						"images/golang.png":     &fstest.MapFile{Data: []byte("golang image")},
+					}),
+					WithDestination(destination))
+				assert.NilError(t, destination.Close())
+				return buf.Bytes()
+			}
+
+			data := resolveArchive()
+
+			files := map[string]string{}
+			var names []string
+			err := readArchive(format, bytes.NewReader(data), func(name string, r io.Reader) error {
+				content, err := io.ReadAll(r)
+				if err != nil {
+					return err
+				}
+				names = append(names, name)
+				files[name] = string(content)
+				return nil
+			})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, []string{"images/559.png", "images/560.png"}, names)
+			assert.Equal(t, "javascript image", files["images/559.png"])
+			assert.Equal(t, "golang image", files["images/560.png"])
+
+			// output must be reproducible.
+			assert.DeepEqual(t, data, resolveArchive())
+		})
+	}
+}
+
+func TestArchiveFileDestination(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "output.tar.gz")
+	destination := NewArchiveFileDestination(filename, "")
+
+	assert.NilError(t, destination.MkdirAll("images", 0o755))
+	f, err := destination.Create("images/file.txt")
+	assert.NilError(t, err)
+	_, err = f.Write([]byte("content"))
+	assert.NilError(t, err)
+	assert.NilError(t, f.Close())
+	assert.NilError(t, destination.Close())
+
+	file, err := os.Open(filename)
+	assert.NilError(t, err)
+	defer file.Close()
+
+	var names []string
+	err = readArchive(ArchiveTarGz, file, func(name string, r io.Reader) error {
+		names = append(names, name)
+		return nil
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"images/file.txt"}, names)
+}
@@ -0,0 +1,283 @@
+package copyfile
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewMemoryDestination creates a [Destination] that keeps all files in memory.
+func NewMemoryDestination() Destination {
+	return newMemoryDestination()
+}
+
+func newMemoryDestination() *memoryDestination {
+	return &memoryDestination{
+		files: map[string]*memoryFile{
+			".": {mode: fs.ModeDir | 0o777, modTime: time.Now()},
+		},
+	}
+}
+
+type memoryDestination struct {
+	m     sync.Mutex
+	files map[string]*memoryFile
+}
+
+type memoryFile struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+var _ Destination = (*memoryDestination)(nil)
+
+func (d *memoryDestination) Open(name string) (fs.File, error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	file, ok := d.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	info := memoryFileInfo{name: path.Base(name), file: *file}
+	if file.mode.IsDir() {
+		return &memoryDirReader{info: info, entries: d.readDir(name)}, nil
+	}
+	return &memoryFileReader{info: info, Reader: bytes.NewReader(file.data)}, nil
+}
+
+func (d *memoryDestination) MkdirAll(name string, perm fs.FileMode) error {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+	var current string
+	for _, part := range strings.Split(name, "/") {
+		current = path.Join(current, part)
+		if file, ok := d.files[current]; ok {
+			if !file.mode.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: current, Err: errors.New("not a directory")}
+			}
+			continue
+		}
+		d.files[current] = &memoryFile{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+	}
+	return nil
+}
+
+func (d *memoryDestination) Create(name string) (DestinationFile, error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if err := d.checkParent("create", name); err != nil {
+		return nil, err
+	}
+	if file, ok := d.files[name]; ok && file.mode.IsDir() {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: errors.New("is a directory")}
+	}
+	d.files[name] = &memoryFile{mode: 0o666, modTime: time.Now()}
+	return &memoryFileWriter{d: d, name: name}, nil
+}
+
+func (d *memoryDestination) CreateTemp(dir, pattern string) (DestinationFile, error) {
+	return createTemp(dir, pattern, func(name string) (DestinationFile, error) {
+		d.m.Lock()
+		defer d.m.Unlock()
+
+		if err := d.checkParent("createtemp", name); err != nil {
+			return nil, err
+		}
+		if _, ok := d.files[name]; ok {
+			return nil, &fs.PathError{Op: "createtemp", Path: name, Err: fs.ErrExist}
+		}
+		d.files[name] = &memoryFile{mode: 0o666, modTime: time.Now()}
+		return &memoryFileWriter{d: d, name: name}, nil
+	})
+}
+
+func (d *memoryDestination) Stat(name string) (fs.FileInfo, error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	file, ok := d.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return memoryFileInfo{name: path.Base(name), file: *file}, nil
+}
+
+func (d *memoryDestination) Remove(name string) error {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	file, ok := d.files[name]
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if file.mode.IsDir() && len(d.readDir(name)) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+	}
+	delete(d.files, name)
+	return nil
+}
+
+func (d *memoryDestination) Rename(oldname, newname string) error {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if !fs.ValidPath(oldname) {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrInvalid}
+	}
+	file, ok := d.files[oldname]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrNotExist}
+	}
+	if file.mode.IsDir() {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: errors.New("renaming directories is not supported")}
+	}
+	if err := d.checkParent("rename", newname); err != nil {
+		return err
+	}
+	if target, ok := d.files[newname]; ok && target.mode.IsDir() {
+		return &fs.PathError{Op: "rename", Path: newname, Err: errors.New("is a directory")}
+	}
+	d.files[newname] = file
+	delete(d.files, oldname)
+	return nil
+}
+
+// checkParent checks if name is valid and its parent is an existing directory.
+func (d *memoryDestination) checkParent(op string, name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	parent, ok := d.files[path.Dir(name)]
+	if !ok {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if !parent.mode.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: errors.New("not a directory")}
+	}
+	return nil
+}
+
+// readDir returns the direct children of the directory name, sorted by name.
+func (d *memoryDestination) readDir(name string) []fs.DirEntry {
+	var ret []fs.DirEntry
+	for fn, file := range d.files {
+		if fn == "." || path.Dir(fn) != name {
+			continue
+		}
+		ret = append(ret, fs.FileInfoToDirEntry(memoryFileInfo{name: path.Base(fn), file: *file}))
+	}
+	slices.SortFunc(ret, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return ret
+}
+
+type memoryFileWriter struct {
+	d      *memoryDestination
+	name   string
+	closed bool
+}
+
+func (w *memoryFileWriter) Write(p []byte) (int, error) {
+	w.d.m.Lock()
+	defer w.d.m.Unlock()
+
+	if w.closed {
+		return 0, fs.ErrClosed
+	}
+	file, ok := w.d.files[w.name]
+	if !ok {
+		return 0, &fs.PathError{Op: "write", Path: w.name, Err: fs.ErrNotExist}
+	}
+	file.data = append(file.data, p...)
+	file.modTime = time.Now()
+	return len(p), nil
+}
+
+func (w *memoryFileWriter) Name() string {
+	return w.name
+}
+
+func (w *memoryFileWriter) Sync() error {
+	if w.closed {
+		return fs.ErrClosed
+	}
+	return nil
+}
+
+func (w *memoryFileWriter) Close() error {
+	if w.closed {
+		return fs.ErrClosed
+	}
+	w.closed = true
+	return nil
+}
+
+type memoryFileInfo struct {
+	name string
+	file memoryFile
+}
+
+func (i memoryFileInfo) Name() string       { return i.name }
+func (i memoryFileInfo) Size() int64        { return int64(len(i.file.data)) }
+func (i memoryFileInfo) Mode() fs.FileMode  { return i.file.mode }
+func (i memoryFileInfo) ModTime() time.Time { return i.file.modTime }
+func (i memoryFileInfo) IsDir() bool        { return i.file.mode.IsDir() }
+func (i memoryFileInfo) Sys() any           { return nil }
+
+type memoryFileReader struct {
+	*bytes.Reader
+	info memoryFileInfo
+}
+
+func (r *memoryFileReader) Stat() (fs.FileInfo, error) { return r.info, nil }
+func (r *memoryFileReader) Close() error               { return nil }
+
+type memoryDirReader struct {
+	info    memoryFileInfo
+	entries []fs.DirEntry
+}
+
+func (r *memoryDirReader) Stat() (fs.FileInfo, error) { return r.info, nil }
+func (r *memoryDirReader) Close() error               { return nil }
+
+func (r *memoryDirReader) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: r.info.name, Err: errors.New("is a directory")}
+}
+
+func (r *memoryDirReader) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		ret := r.entries
+		r.entries = nil
+		return ret, nil
+	}
+	if len(r.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(r.entries))
+	ret := r.entries[:n]
+	r.entries = r.entries[n:]
+	return ret, nil
+}
@@ -0,0 +1,71 @@
+package copyfile
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDestination(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		destination func(t *testing.T) Destination
+	}{
+		{
+			name: "os",
+			destination: func(t *testing.T) Destination {
+				return NewOSDestination(t.TempDir())
+			},
+		},
+		{
+			name: "memory",
+			destination: func(t *testing.T) Destination {
+				return NewMemoryDestination()
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			d := test.destination(t)
+
+			_, err := d.Create("a/b/file.txt")
+			assert.Assert(t, errors.Is(err, fs.ErrNotExist))
+
+			assert.NilError(t, d.MkdirAll("a/b", 0o755))
+
+			f, err := d.Create("a/b/file.txt")
+			assert.NilError(t, err)
+			_, err = f.Write([]byte("content"))
+			assert.NilError(t, err)
+			assert.NilError(t, f.Close())
+
+			stat, err := d.Stat("a/b/file.txt")
+			assert.NilError(t, err)
+			assert.Equal(t, int64(7), stat.Size())
+			assert.Assert(t, stat.Mode().IsRegular())
+
+			assert.NilError(t, d.Rename("a/b/file.txt", "a/file.txt"))
+			_, err = d.Stat("a/b/file.txt")
+			assert.Assert(t, errors.Is(err, fs.ErrNotExist))
+
+			content, err := fs.ReadFile(d, "a/file.txt")
+			assert.NilError(t, err)
+			assert.Equal(t, "content", string(content))
+
+			entries, err := fs.ReadDir(d, "a")
+			assert.NilError(t, err)
+			assert.Equal(t, 2, len(entries))
+			assert.Equal(t, "b", entries[0].Name())
+			assert.Assert(t, entries[0].IsDir())
+			assert.Equal(t, "file.txt", entries[1].Name())
+
+			assert.Assert(t, d.Remove("a") != nil)
+			assert.NilError(t, d.Remove("a/file.txt"))
+			assert.NilError(t, d.Remove("a/b"))
+			assert.NilError(t, d.Remove("a"))
+			_, err = d.Stat("a")
+			assert.Assert(t, errors.Is(err, fs.ErrNotExist))
+		})
+	}
+}
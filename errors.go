@@ -0,0 +1,82 @@
+package copyfile
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rrgmc/debefix"
+)
+
+var (
+	ErrPathEscapesRoot         = errors.New("path escapes its root directory")
+	ErrDestinationInsideSource = errors.New("destination is inside the source root directory")
+	ErrDestinationExists       = errors.New("destination file already exists")
+	ErrChecksumMismatch        = errors.New("checksum mismatch")
+	ErrUnclosedField           = errors.New("unclosed field")
+	ErrEmptyField              = errors.New("empty field")
+	ErrEmptyFieldFunc          = errors.New("empty field function name")
+	ErrUnexpectedCloseBrace    = errors.New("unexpected closing curly-brace")
+	ErrUnclosedOptional        = errors.New("unclosed optional group")
+	ErrNestedOptional          = errors.New("nested optional group")
+	ErrUnsafePathValue         = errors.New("unsafe path value")
+)
+
+// PathEscapeError is returned when a resolved source or destination path is outside its root directory.
+type PathEscapeError struct {
+	TableID   string
+	RowID     string
+	FieldName string
+	Path      string
+	Err       error
+}
+
+func (e *PathEscapeError) Error() string {
+	return fmt.Sprintf("table '%s' row '%s' field '%s': invalid path '%s': %s",
+		e.TableID, e.RowID, e.FieldName, e.Path, e.Err)
+}
+
+func (e *PathEscapeError) Unwrap() error {
+	return e.Err
+}
+
+// ChecksumError is returned when the SHA-256 of a copied file doesn't match the expected one. It wraps
+// ErrChecksumMismatch.
+type ChecksumError struct {
+	TableID   string
+	RowID     string
+	FieldName string
+	Path      string
+	Expected  string
+	Actual    string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("table '%s' row '%s' field '%s': %s for '%s': expected sha256 '%s', got '%s'",
+		e.TableID, e.RowID, e.FieldName, ErrChecksumMismatch, e.Path, e.Expected, e.Actual)
+}
+
+func (e *ChecksumError) Unwrap() error {
+	return ErrChecksumMismatch
+}
+
+// FieldsParseError is returned by ParseFieldsStrict when the string has an invalid field.
+type FieldsParseError struct {
+	Offset int // byte offset of the error in the parsed string.
+	Err    error
+}
+
+func (e *FieldsParseError) Error() string {
+	return fmt.Sprintf("%s at offset %d", e.Err, e.Offset)
+}
+
+func (e *FieldsParseError) Unwrap() error {
+	return e.Err
+}
+
+// rowID returns a row identification to be used in errors, the refid if set or the internal ID otherwise.
+func rowID(row debefix.Row) string {
+	if row.Config.RefID != "" {
+		return row.Config.RefID
+	}
+	return row.InternalID.String()
+}
@@ -0,0 +1,174 @@
+package copyfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// expandedFile is a source file expanded from a directory or glob pattern, with its destination.
+type expandedFile struct {
+	source      string
+	destination string
+	content     []byte        // file content, if it was already read, like files extracted from archives.
+	entry       *archiveEntry // position of the file in the source archive, if extracted from one.
+}
+
+// expandSource expands the source if it is a directory or a glob pattern, returning the list of files to copy.
+// Other sources are returned unchanged.
+func (c *CopyFile) expandSource(fileData FileData, source, destination string) ([]expandedFile, error) {
+	single := []expandedFile{{source: source, destination: destination}}
+	if source == "" || fileData.Content != nil || fileData.Generate != nil {
+		return single, nil
+	}
+
+	sourceFS, err := c.sourceFileSystem()
+	if err != nil {
+		return nil, err
+	}
+
+	var baseDir, pattern string
+	source = fsPath(source)
+	if isGlobPattern(source) {
+		baseDir, pattern = splitGlobPattern(source)
+	} else {
+		stat, err := fs.Stat(sourceFS, source)
+		if err != nil || !stat.IsDir() {
+			// let the copy report the error.
+			return single, nil
+		}
+		baseDir, pattern = source, "**"
+	}
+	if fileData.SHA256 != "" {
+		return nil, fmt.Errorf("sha256 can only be set for single files, '%s' is a directory or glob pattern", source)
+	}
+
+	var ret []expandedFile
+	err = fs.WalkDir(sourceFS, baseDir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && name == baseDir {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel := name
+		if baseDir != "." {
+			rel = strings.TrimPrefix(name, baseDir+"/")
+		}
+		if ok, err := matchFile(rel, pattern, fileData.Include, fileData.Exclude); err != nil || !ok {
+			return err
+		}
+		ret = append(ret, expandedFile{
+			source:      name,
+			destination: path.Join(fsPath(destination), rel),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		if c.dryRun {
+			// the plan will report that the source doesn't exist.
+			return single, nil
+		}
+		return nil, fmt.Errorf("no files found in source '%s'", source)
+	}
+	return ret, nil
+}
+
+// sourceFileSystem returns the source filesystem, or the source path as a filesystem.
+func (c *CopyFile) sourceFileSystem() (fs.FS, error) {
+	if c.sourceFS != nil {
+		return c.sourceFS, nil
+	}
+	if c.sourcePath != "" {
+		return os.DirFS(c.sourcePath), nil
+	}
+	return nil, errors.New("source path or filesystem is required")
+}
+
+// matchFile returns whether the relative file name matches the pattern and the include filters, and doesn't match
+// the exclude filters.
+func matchFile(name string, pattern string, include, exclude []string) (bool, error) {
+	if ok, err := matchGlob(pattern, name); err != nil || !ok {
+		return false, err
+	}
+	if len(include) > 0 {
+		included := false
+		for _, includePattern := range include {
+			ok, err := matchGlob(includePattern, name)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false, nil
+		}
+	}
+	for _, excludePattern := range exclude {
+		if ok, err := matchGlob(excludePattern, name); err != nil || ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// isGlobPattern returns whether the path contains glob meta characters.
+func isGlobPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// splitGlobPattern splits a glob pattern in the base directory without meta characters, and the pattern relative
+// to it.
+func splitGlobPattern(pattern string) (string, string) {
+	parts := strings.Split(pattern, "/")
+	for i, part := range parts {
+		if isGlobPattern(part) {
+			if i == 0 {
+				return ".", pattern
+			}
+			return path.Join(parts[:i]...), path.Join(parts[i:]...)
+		}
+	}
+	return path.Dir(pattern), path.Base(pattern)
+}
+
+// matchGlob returns whether the slash-separated name matches the pattern. Besides the [path.Match] syntax, a "**"
+// path segment matches zero or more directories.
+func matchGlob(pattern, name string) (bool, error) {
+	return matchGlobParts(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobParts(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if ok, err := matchGlobParts(pattern[1:], name[i:]); err != nil || ok {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false, err
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0, nil
+}
@@ -0,0 +1,135 @@
+package copyfile
+
+import (
+	"fmt"
+	"io/fs"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestExpandSource(t *testing.T) {
+	sourceFS := fstest.MapFS{
+		"themes/dark/style.css":         &fstest.MapFile{Data: []byte("style")},
+		"themes/dark/components/a.css":  &fstest.MapFile{Data: []byte("a")},
+		"themes/dark/components/b.css":  &fstest.MapFile{Data: []byte("b")},
+		"themes/dark/components/b.scss": &fstest.MapFile{Data: []byte("b scss")},
+		"themes/dark/images/logo.png":   &fstest.MapFile{Data: []byte("logo")},
+		"themes/light/style.css":        &fstest.MapFile{Data: []byte("light style")},
+	}
+
+	for _, test := range []struct {
+		name          string
+		source        string
+		include       string
+		exclude       string
+		expectedFiles []string
+	}{
+		{
+			name:   "directory",
+			source: "themes/dark",
+			expectedFiles: []string{
+				"tenant/components/a.css",
+				"tenant/components/b.css",
+				"tenant/components/b.scss",
+				"tenant/images/logo.png",
+				"tenant/style.css",
+			},
+		},
+		{
+			name:   "glob",
+			source: "themes/dark/**/*.css",
+			expectedFiles: []string{
+				"tenant/components/a.css",
+				"tenant/components/b.css",
+				"tenant/style.css",
+			},
+		},
+		{
+			name:   "glob single level",
+			source: "themes/*/style.css",
+			expectedFiles: []string{
+				"tenant/dark/style.css",
+				"tenant/light/style.css",
+			},
+		},
+		{
+			name:    "include exclude",
+			source:  "themes/dark",
+			include: `["components/**", "*.css"]`,
+			exclude: `["**/b.*"]`,
+			expectedFiles: []string{
+				"tenant/components/a.css",
+				"tenant/style.css",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			include, exclude := test.include, test.exclude
+			if include == "" {
+				include = "[]"
+			}
+			if exclude == "" {
+				exclude = "[]"
+			}
+
+			destination := NewMemoryDestination()
+			c := New(WithSourceFS(sourceFS), WithDestination(destination))
+
+			_, err := resolveTestCopyFile(t, c, fmt.Sprintf(`tables:
+  tenants:
+    rows:
+      - tenant_id: 987
+        theme:
+          !copyfile
+          source: "%s"
+          destination: "tenant"
+          include: %s
+          exclude: %s
+`, test.source, include, exclude))
+			assert.NilError(t, err)
+
+			var files []string
+			err = fs.WalkDir(destination, ".", func(path string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					files = append(files, path)
+				}
+				return err
+			})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, test.expectedFiles, files)
+
+			var manifestFiles []string
+			for _, entry := range c.Manifest() {
+				manifestFiles = append(manifestFiles, entry.Destination)
+			}
+			slices.Sort(manifestFiles)
+			assert.DeepEqual(t, test.expectedFiles, manifestFiles)
+		})
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	for _, test := range []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"**", "a/b/c.css", true},
+		{"**/*.css", "c.css", true},
+		{"**/*.css", "a/b/c.css", true},
+		{"**/*.css", "a/b/c.scss", false},
+		{"a/**/c.css", "a/c.css", true},
+		{"a/**/c.css", "a/b/d/c.css", true},
+		{"a/*/c.css", "a/b/d/c.css", false},
+		{"*.css", "a/c.css", false},
+	} {
+		t.Run(test.pattern+" "+test.name, func(t *testing.T) {
+			ok, err := matchGlob(test.pattern, test.name)
+			assert.NilError(t, err)
+			assert.Equal(t, test.expected, ok)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package copyfile
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// FieldFunc is a function which transforms a field value, used in field pipes like "{value:name|lower}".
+// The arguments are the pipe text after the function name, split by ":", like "{value:name|replace:a:b}".
+type FieldFunc func(value any, args []string) (any, error)
+
+// DefaultFieldFuncs returns the built-in field functions:
+//
+//   - lower, upper: converts the value to lower or upper case.
+//   - slug: converts the value to a lower case string with only letters, digits and "-".
+//   - trim: removes leading and trailing spaces, or the characters passed as argument.
+//   - replace:old:new: replaces all occurrences of old with new.
+//   - printf:format: formats the value using [fmt.Sprintf], like "printf:%06d".
+//   - date:layout: formats a [time.Time], or a RFC 3339 or "2006-01-02" string, using the [time.Time.Format] layout.
+//   - base, ext: returns the last element or the extension of the value as a slash-separated path.
+//   - sha1: returns the hex-encoded SHA-1 of the value.
+//   - truncate:n: truncates the value to at most n characters.
+//
+// For printf and date, arguments are joined back with ":", so they can be used in the format.
+func DefaultFieldFuncs() map[string]FieldFunc {
+	return map[string]FieldFunc{
+		"lower":    stringFieldFunc(strings.ToLower),
+		"upper":    stringFieldFunc(strings.ToUpper),
+		"slug":     stringFieldFunc(slug),
+		"trim":     fieldFuncTrim,
+		"replace":  fieldFuncReplace,
+		"printf":   fieldFuncPrintf,
+		"date":     fieldFuncDate,
+		"base":     stringFieldFunc(path.Base),
+		"ext":      stringFieldFunc(path.Ext),
+		"sha1":     stringFieldFunc(sha1Hex),
+		"truncate": fieldFuncTruncate,
+	}
+}
+
+// stringFieldFunc returns a field function which applies f to the value formatted as a string.
+func stringFieldFunc(f func(string) string) FieldFunc {
+	return func(value any, args []string) (any, error) {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("no arguments expected")
+		}
+		return f(fmt.Sprint(value)), nil
+	}
+}
+
+func fieldFuncTrim(value any, args []string) (any, error) {
+	if len(args) == 0 {
+		return strings.TrimSpace(fmt.Sprint(value)), nil
+	}
+	return strings.Trim(fmt.Sprint(value), strings.Join(args, ":")), nil
+}
+
+func fieldFuncReplace(value any, args []string) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("old and new arguments expected")
+	}
+	return strings.ReplaceAll(fmt.Sprint(value), args[0], args[1]), nil
+}
+
+func fieldFuncPrintf(value any, args []string) (any, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("format argument expected")
+	}
+	return fmt.Sprintf(strings.Join(args, ":"), value), nil
+}
+
+func fieldFuncDate(value any, args []string) (any, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("layout argument expected")
+	}
+	var t time.Time
+	switch tv := value.(type) {
+	case time.Time:
+		t = tv
+	case string:
+		var err error
+		if t, err = time.Parse(time.RFC3339, tv); err != nil {
+			if t, err = time.Parse(time.DateOnly, tv); err != nil {
+				return nil, fmt.Errorf("invalid date '%s'", tv)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid date type %T", value)
+	}
+	return t.Format(strings.Join(args, ":")), nil
+}
+
+func fieldFuncTruncate(value any, args []string) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("length argument expected")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid length '%s'", args[0])
+	}
+	str := []rune(fmt.Sprint(value))
+	if len(str) > n {
+		str = str[:n]
+	}
+	return string(str), nil
+}
+
+// slug converts str to lower case, replacing each sequence of characters which are not letters or digits with "-".
+func slug(str string) string {
+	var sb strings.Builder
+	dash := false
+	for _, ch := range strings.ToLower(str) {
+		if unicode.IsLetter(ch) || unicode.IsDigit(ch) {
+			if dash && sb.Len() > 0 {
+				sb.WriteByte('-')
+			}
+			sb.WriteRune(ch)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return sb.String()
+}
+
+func sha1Hex(str string) string {
+	sum := sha1.Sum([]byte(str))
+	return hex.EncodeToString(sum[:])
+}
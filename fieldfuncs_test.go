@@ -0,0 +1,85 @@
+package copyfile
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestReplaceFieldPipes(t *testing.T) {
+	values := map[string]any{
+		"id":      uint64(42),
+		"name":    "  Go Lang: The Book  ",
+		"created": time.Date(2024, 3, 5, 10, 20, 0, 0, time.UTC),
+		"date":    "2024-03-05",
+		"file":    "images/logo.png",
+	}
+
+	for _, test := range []struct {
+		str         string
+		expected    string
+		expectedErr string
+	}{
+		{str: "{id|printf:%06d}", expected: "000042"},
+		{str: "{name|trim|lower}", expected: "go lang: the book"},
+		{str: "{name|upper|trim}", expected: "GO LANG: THE BOOK"},
+		{str: "{name|slug}", expected: "go-lang-the-book"},
+		{str: "{name|trim|replace: :_}", expected: "Go_Lang:_The_Book"},
+		{str: "{created|date:2006/01/02 15:04}", expected: "2024/03/05 10:20"},
+		{str: "{date|date:02-01-2006}", expected: "05-03-2024"},
+		{str: "{file|base}", expected: "logo.png"},
+		{str: "{file|ext}", expected: ".png"},
+		{str: "{id|sha1}", expected: "92cfceb39d57d914ed8b14d0e37643de0797ae56"},
+		{str: "{name|trim|truncate:6}", expected: "Go Lan"},
+		{str: "{id|unknown}", expectedErr: "unknown field function 'unknown'"},
+		{str: "{id|truncate:x}", expectedErr: "invalid length 'x'"},
+	} {
+		t.Run(test.str, func(t *testing.T) {
+			value, err := ReplaceFields(test.str, values)
+			if test.expectedErr != "" {
+				assert.ErrorContains(t, err, test.expectedErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, test.expected, value)
+		})
+	}
+}
+
+func TestCopyFileFieldFunc(t *testing.T) {
+	destination := NewMemoryDestination()
+	resolvedData := resolveTestData(t, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tag_name: "JavaScript"
+        tagfilename:
+          !copyfile
+          source: "images/{value:tag_name|lower}.png"
+          destination: "images/{value:tag_id|printf:%06d}/{value:tag_name|reverse}.png"
+          value: "{value:tag_name|reverse|upper}"
+`,
+		WithSourceFS(fstest.MapFS{
+			"images/javascript.png": &fstest.MapFile{Data: []byte("javascript image")},
+		}),
+		WithDestination(destination),
+		WithFieldFunc("reverse", func(value any, args []string) (any, error) {
+			var sb strings.Builder
+			str := []rune(fmt.Sprint(value))
+			for i := len(str) - 1; i >= 0; i-- {
+				sb.WriteRune(str[i])
+			}
+			return sb.String(), nil
+		}))
+
+	assert.Equal(t, "TPIRCSAVAJ", resolvedData.Tables["tags"].Rows[0].Fields["tagfilename"])
+
+	content, err := fs.ReadFile(destination, "images/000559/tpircSavaJ.png")
+	assert.NilError(t, err)
+	assert.Equal(t, "javascript image", string(content))
+}
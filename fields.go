@@ -2,83 +2,289 @@ package copyfile
 
 import (
 	"bytes"
-	"cmp"
 	"fmt"
-	"slices"
 	"strings"
-
-	"golang.org/x/exp/maps"
 )
 
 // ReplaceFields parses curly-brace-delimited fields in strings and replaces them with values.
 // To escape a curly-brace, add two consecutive ones.
-func ReplaceFields(str string, values map[string]any) (string, error) {
-	return ParseFields(str).Replace(values)
+func ReplaceFields(str string, values map[string]any, options ...ReplaceOption) (string, error) {
+	return ParseFields(str).Replace(values, options...)
 }
 
 // ParseFields parses curly-brace-delimited fields in strings and allows listing and replacing them.
 // To escape a curly-brace, add two consecutive ones.
+// Fields can be followed by pipes to functions which transform the value, like "{value:name|lower|truncate:10}".
+// A default value, used if the field is missing, nil or empty, can be set after ":-", like "{value:ext:-png}".
+// Optional groups, like "{?{value:category}/}", are removed if any of their fields is missing, nil or empty. They can
+// end with a field, like "photo{?-{value:variant}}.png".
+// Unclosed fields and unescaped closing curly-braces are kept as literal text.
 func ParseFields(str string) *ParsedFields {
 	ret := &ParsedFields{
-		str:    str,
-		fields: make(map[string]parsedFieldsField),
+		str: str,
 	}
-	ret.parse()
+	_ = ret.parse(false)
 	return ret
 }
 
+// ParseFieldsStrict is like ParseFields, but returns a [*FieldsParseError] with the byte offset of the first unclosed
+// or empty field, empty pipe function name, unclosed or nested optional group, or unescaped closing curly-brace.
+func ParseFieldsStrict(str string) (*ParsedFields, error) {
+	ret := &ParsedFields{
+		str: str,
+	}
+	if err := ret.parse(true); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
 const (
-	openBrace  = '{'
-	closeBrace = '}'
+	openBrace        = '{'
+	closeBrace       = '}'
+	optionalMark     = '?'
+	defaultSeparator = ":-"
 )
 
 // ParsedFields stores the parsed fields from ParseFields.
 type ParsedFields struct {
-	str    string
-	fields map[string]parsedFieldsField
+	str      string
+	segments []Segment
 }
 
-// Fields returns the list of fields found.
-func (s *ParsedFields) Fields() []string {
-	return maps.Keys(s.fields)
+// SegmentKind is the kind of a parsed segment.
+type SegmentKind int
+
+const (
+	SegmentLiteral  SegmentKind = iota // literal text.
+	SegmentField                       // curly-brace-delimited field.
+	SegmentOptional                    // optional group, like "{?{value:category}/}".
+)
+
+// Segment is a part of a parsed string, either literal text, a field, or an optional group of segments.
+type Segment struct {
+	Kind     SegmentKind
+	Value    string      // literal text with escapes collapsed, or the field name without the curly-braces and pipes.
+	Default  *string     // field default value, like "png" in "{value:ext:-png}".
+	Pipes    []FieldPipe // field pipes, in order.
+	Segments []Segment   // segments of the optional group.
+	Start    int         // byte offset of the segment start in the parsed string.
+	End      int         // byte offset after the segment end in the parsed string.
 }
 
-// Replace returns a new string with all fields replaced with values.
-func (s *ParsedFields) Replace(values map[string]any) (string, error) {
-	fields := maps.Values(s.fields)
-	slices.SortFunc(fields, func(a, b parsedFieldsField) int {
-		return cmp.Compare(a.start, b.start)
+// FieldPipe is a function applied to a field value, like "printf:%06d" in "{value:tag_id|printf:%06d}".
+type FieldPipe struct {
+	Name string
+	Args []string
+}
+
+// WithReplaceSanitize sanitizes the field values using SanitizeValue after applying the pipes, so any "/" in the value
+// is escaped, replaced or rejected. For fields piped to a function whose separators only come from its own arguments,
+// like "date:2006/01/02", each "/"-separated part of the result is sanitized on its own, so they can create
+// directories. Default values are not sanitized.
+func WithReplaceSanitize(policy SanitizePolicy, maxLength int) ReplaceOption {
+	return func(o *replaceOptions) {
+		o.sanitize = true
+		o.sanitizePolicy = policy
+		o.sanitizeMaxLength = maxLength
+	}
+}
+
+// withReplaceTrustedFields sets fields which are never sanitized.
+func withReplaceTrustedFields(fields map[string]bool) ReplaceOption {
+	return func(o *replaceOptions) {
+		o.trustedFields = fields
+	}
+}
+
+// ReplaceOption is an option for ParsedFields.Replace.
+type ReplaceOption func(*replaceOptions)
+
+type replaceOptions struct {
+	fieldFuncs        map[string]FieldFunc
+	sanitize          bool
+	sanitizePolicy    SanitizePolicy
+	sanitizeMaxLength int
+	trustedFields     map[string]bool
+	pathFieldFuncs    map[string]bool // built-in functions whose "/" only come from their arguments.
+}
+
+// WithReplaceFieldFuncs adds functions to be used in field pipes, besides the ones in DefaultFieldFuncs.
+func WithReplaceFieldFuncs(fieldFuncs map[string]FieldFunc) ReplaceOption {
+	return func(o *replaceOptions) {
+		for name, fn := range fieldFuncs {
+			o.fieldFuncs[name] = fn
+			delete(o.pathFieldFuncs, name)
+		}
+	}
+}
+
+// Segments returns the literal text, field and optional group segments of the string, in order.
+func (s *ParsedFields) Segments() []Segment {
+	return append([]Segment(nil), s.segments...)
+}
+
+// Fields returns the list of fields found, including the ones in optional groups, without duplicates, in the order
+// they first appear.
+func (s *ParsedFields) Fields() []string {
+	var ret []string
+	found := map[string]bool{}
+	walkFieldSegments(s.segments, false, func(segment Segment, inOptional bool) {
+		if !found[segment.Value] {
+			found[segment.Value] = true
+			ret = append(ret, segment.Value)
+		}
 	})
+	return ret
+}
 
-	var sb strings.Builder
-	curstart := 0
-	for _, field := range fields {
-		if curstart < field.start {
-			sb.WriteString(s.str[curstart:field.start])
+// OptionalFields returns the fields which may be missing, because all their occurrences have a default value or
+// are in optional groups.
+func (s *ParsedFields) OptionalFields() []string {
+	required := map[string]bool{}
+	walkFieldSegments(s.segments, false, func(segment Segment, inOptional bool) {
+		if segment.Default == nil && !inOptional {
+			required[segment.Value] = true
 		}
-		fv, ok := values[field.name]
-		if !ok {
-			return "", fmt.Errorf("field '%s' not set", field.name)
+	})
+	var ret []string
+	for _, field := range s.Fields() {
+		if !required[field] {
+			ret = append(ret, field)
 		}
-		sb.WriteString(fmt.Sprint(fv))
-		curstart = field.end
 	}
-	if curstart < len(s.str) {
-		sb.WriteString(s.str[curstart:])
+	return ret
+}
+
+// walkFieldSegments calls fn for each field segment, including the ones in optional groups.
+func walkFieldSegments(segments []Segment, inOptional bool, fn func(segment Segment, inOptional bool)) {
+	for _, segment := range segments {
+		switch segment.Kind {
+		case SegmentField:
+			fn(segment, inOptional)
+		case SegmentOptional:
+			walkFieldSegments(segment.Segments, true, fn)
+		}
 	}
+}
 
+// Replace returns a new string with all fields replaced with values, after applying the field pipes.
+// With WithReplaceSanitize, the results of the pipes are sanitized.
+// Fields with a default value use it if they are missing, nil or empty. Optional groups are removed if any of their
+// fields without a default value is missing, nil or empty.
+func (s *ParsedFields) Replace(values map[string]any, options ...ReplaceOption) (string, error) {
+	optns := replaceOptions{
+		fieldFuncs:     DefaultFieldFuncs(),
+		pathFieldFuncs: map[string]bool{"date": true},
+	}
+	for _, opt := range options {
+		opt(&optns)
+	}
+
+	var sb strings.Builder
+	if _, err := replaceSegments(&sb, s.segments, values, false, &optns); err != nil {
+		return "", err
+	}
 	return sb.String(), nil
 }
 
-func (s *ParsedFields) parse() {
+// replaceSegments writes the replaced segments to sb. In an optional group, it returns false without writing
+// anything if a field without a default value is missing, nil or empty.
+func replaceSegments(sb *strings.Builder, segments []Segment, values map[string]any, isOptional bool,
+	optns *replaceOptions) (bool, error) {
+	var gsb strings.Builder
+	for _, segment := range segments {
+		switch segment.Kind {
+		case SegmentLiteral:
+			gsb.WriteString(segment.Value)
+		case SegmentField:
+			fv, ok := values[segment.Value]
+			sanitize := optns.sanitize && !optns.trustedFields[segment.Value]
+			if isEmptyValue(fv, ok) {
+				switch {
+				case segment.Default != nil:
+					fv, ok, sanitize = *segment.Default, true, false
+				case isOptional:
+					return false, nil
+				}
+			}
+			if !ok {
+				return false, fmt.Errorf("field '%s' not set", segment.Value)
+			}
+			fv, err := applyFieldPipes(fv, segment.Pipes, optns.fieldFuncs)
+			if err != nil {
+				return false, fmt.Errorf("field '%s': %w", segment.Value, err)
+			}
+			if sanitize {
+				fv, err = sanitizeFieldValue(fv, hasPathFieldFunc(segment.Pipes, optns.pathFieldFuncs),
+					optns.sanitizePolicy, optns.sanitizeMaxLength)
+				if err != nil {
+					return false, fmt.Errorf("field '%s': %w", segment.Value, err)
+				}
+			}
+			gsb.WriteString(fmt.Sprint(fv))
+		case SegmentOptional:
+			if _, err := replaceSegments(&gsb, segment.Segments, values, true, optns); err != nil {
+				return false, err
+			}
+		}
+	}
+	sb.WriteString(gsb.String())
+	return true, nil
+}
+
+// isEmptyValue returns whether a field value is missing, nil or an empty string.
+func isEmptyValue(value any, ok bool) bool {
+	if !ok || value == nil {
+		return true
+	}
+	if str, isString := value.(string); isString && str == "" {
+		return true
+	}
+	return false
+}
+
+// hasPathFieldFunc returns whether any of the pipes calls a function whose "/" only come from its arguments.
+func hasPathFieldFunc(pipes []FieldPipe, pathFieldFuncs map[string]bool) bool {
+	for _, pipe := range pipes {
+		if pathFieldFuncs[pipe.Name] {
+			return true
+		}
+	}
+	return false
+}
+
+// applyFieldPipes calls the pipe functions in order, passing the result of each one to the next.
+func applyFieldPipes(value any, pipes []FieldPipe, fieldFuncs map[string]FieldFunc) (any, error) {
+	for _, pipe := range pipes {
+		fn, ok := fieldFuncs[pipe.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown field function '%s'", pipe.Name)
+		}
+		var err error
+		if value, err = fn(value, pipe.Args); err != nil {
+			return nil, fmt.Errorf("error calling field function '%s': %w", pipe.Name, err)
+		}
+	}
+	return value, nil
+}
+
+// parse parses the string. In strict mode, it returns an error on unclosed or empty fields, unclosed or nested
+// optional groups and unescaped closing curly-braces.
+func (s *ParsedFields) parse(strict bool) error {
 	r := newParser(s.str)
 
 	isOpen := false
 	start := 0
-	idx := 0
+	literalStart := 0
 	var paramName bytes.Buffer
 
+	// segments of the current optional group, or nil if not in a group.
+	var group *Segment
+	target := &s.segments
+
 	for {
+		pos := r.offset()
 		ch, ok := r.next()
 		if !ok {
 			break
@@ -90,46 +296,132 @@ func (s *ParsedFields) parse() {
 				// check for escaping
 				nch, ok := r.next()
 				if !ok || nch != openBrace {
+					if ok && nch == optionalMark && group == nil {
+						// start optional group
+						s.addLiteral(target, literalStart, pos)
+						group = &Segment{Kind: SegmentOptional, Start: pos}
+						target = &group.Segments
+						literalStart = r.offset()
+						isWriteChar = false
+						break
+					}
 					if ok {
+						if strict && nch == optionalMark {
+							return &FieldsParseError{Offset: pos, Err: ErrNestedOptional}
+						}
 						r.unread()
 					}
 					isOpen = true
-					start = idx
+					start = pos
 					paramName.Reset()
 					isWriteChar = false
-				} else {
-					idx++
 				}
 			}
 		case ch == closeBrace:
-			if isOpen {
+			if !isOpen {
 				// check for escaping
 				nch, ok := r.next()
 				if !ok || nch != closeBrace {
 					if ok {
 						r.unread()
 					}
-					s.fields[paramName.String()] = parsedFieldsField{
-						name:  paramName.String(),
-						start: start,
-						end:   idx + 1,
+					if group != nil {
+						// end optional group
+						s.addLiteral(target, literalStart, pos)
+						group.End = pos + 1
+						s.segments = append(s.segments, *group)
+						group = nil
+						target = &s.segments
+						literalStart = pos + 1
+					} else if strict {
+						return &FieldsParseError{Offset: pos, Err: ErrUnexpectedCloseBrace}
+					}
+				}
+			} else {
+				// check for escaping. In an optional group, "}}" closes the field and then the group, so groups
+				// can end with a field.
+				nch, ok := r.next()
+				if !ok || nch != closeBrace || group != nil {
+					if ok {
+						r.unread()
+					}
+					name, defaultValue, pipes := parseField(paramName.String())
+					if strict {
+						if name == "" {
+							return &FieldsParseError{Offset: start, Err: ErrEmptyField}
+						}
+						for _, pipe := range pipes {
+							if pipe.Name == "" {
+								return &FieldsParseError{Offset: start, Err: ErrEmptyFieldFunc}
+							}
+						}
 					}
+					s.addLiteral(target, literalStart, start)
+					*target = append(*target, Segment{
+						Kind:    SegmentField,
+						Value:   name,
+						Default: defaultValue,
+						Pipes:   pipes,
+						Start:   start,
+						End:     pos + 1,
+					})
+					literalStart = pos + 1
 					isOpen = false
 					isWriteChar = false
-				} else {
-					idx++
 				}
 			}
 		}
 		if isWriteChar && isOpen {
 			_, _ = paramName.WriteRune(ch)
 		}
-		idx++
 	}
+	if isOpen && strict {
+		return &FieldsParseError{Offset: start, Err: ErrUnclosedField}
+	}
+	// an unclosed field is kept as literal text.
+	s.addLiteral(target, literalStart, len(s.str))
+	if group != nil {
+		if strict {
+			return &FieldsParseError{Offset: group.Start, Err: ErrUnclosedOptional}
+		}
+		// an unclosed optional group is kept as a non-optional one.
+		s.addLiteral(&s.segments, group.Start, group.Start+2)
+		s.segments = append(s.segments, group.Segments...)
+	}
+	return nil
 }
 
-type parsedFieldsField struct {
-	name  string
-	start int
-	end   int
+// parseField splits the field text in the field name, its default value and its pipes, like
+// "name:-default|func:arg1:arg2".
+func parseField(field string) (string, *string, []FieldPipe) {
+	parts := strings.Split(field, "|")
+	var pipes []FieldPipe
+	for _, part := range parts[1:] {
+		args := strings.Split(part, ":")
+		pipe := FieldPipe{Name: strings.TrimSpace(args[0])}
+		if len(args) > 1 {
+			pipe.Args = args[1:]
+		}
+		pipes = append(pipes, pipe)
+	}
+	if name, defaultValue, ok := strings.Cut(parts[0], defaultSeparator); ok {
+		return name, &defaultValue, pipes
+	}
+	return parts[0], nil, pipes
+}
+
+// escapeReplacer collapses escaped curly-braces in literal text.
+var escapeReplacer = strings.NewReplacer("{{", "{", "}}", "}")
+
+// addLiteral adds the text between start and end as a literal segment to target, if not empty.
+func (s *ParsedFields) addLiteral(target *[]Segment, start, end int) {
+	if start >= end {
+		return
+	}
+	*target = append(*target, Segment{
+		Kind:  SegmentLiteral,
+		Value: escapeReplacer.Replace(s.str[start:end]),
+		Start: start,
+		End:   end,
+	})
 }
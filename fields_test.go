@@ -2,6 +2,7 @@ package copyfile
 
 import (
 	"cmp"
+	"errors"
 	"fmt"
 	"testing"
 
@@ -70,12 +71,15 @@ func TestParse(t *testing.T) {
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			p := ParseFields(test.str)
-			assert.DeepEqual(t, maps.Keys(test.expectedFields), maps.Keys(p.fields), cmpopts.SortSlices(cmp.Less[string]))
-			for fn, field := range p.fields {
-				fv := p.str[field.start:field.end]
-				fexpected := test.expectedFields[fn]
+			assert.DeepEqual(t, maps.Keys(test.expectedFields), p.Fields(), cmpopts.SortSlices(cmp.Less[string]))
+			for _, segment := range p.Segments() {
+				if segment.Kind != SegmentField {
+					continue
+				}
+				fv := test.str[segment.Start:segment.End]
+				fexpected := test.expectedFields[segment.Value]
 				if fexpected == "" {
-					fexpected = fmt.Sprintf("{%s}", field.name)
+					fexpected = fmt.Sprintf("{%s}", segment.Value)
 				}
 				assert.Equal(t, fexpected, fv)
 			}
@@ -83,6 +87,32 @@ func TestParse(t *testing.T) {
 	}
 }
 
+func TestSegments(t *testing.T) {
+	p := ParseFields("images/{value:tag_id}/{value:tag_id}.png")
+	assert.DeepEqual(t, []Segment{
+		{Kind: SegmentLiteral, Value: "images/", Start: 0, End: 7},
+		{Kind: SegmentField, Value: "value:tag_id", Start: 7, End: 21},
+		{Kind: SegmentLiteral, Value: "/", Start: 21, End: 22},
+		{Kind: SegmentField, Value: "value:tag_id", Start: 22, End: 36},
+		{Kind: SegmentLiteral, Value: ".png", Start: 36, End: 40},
+	}, p.Segments())
+	assert.DeepEqual(t, []string{"value:tag_id"}, p.Fields())
+
+	p = ParseFields("{value:tag_id|printf:%06d|replace:0:x}")
+	assert.DeepEqual(t, []Segment{
+		{Kind: SegmentField, Value: "value:tag_id", Pipes: []FieldPipe{
+			{Name: "printf", Args: []string{"%06d"}},
+			{Name: "replace", Args: []string{"0", "x"}},
+		}, Start: 0, End: 38},
+	}, p.Segments())
+}
+
+func TestOptionalFields(t *testing.T) {
+	p := ParseFields("{?{category}/}{tenant}/{ext:-png}.{ext}")
+	assert.DeepEqual(t, []string{"category", "tenant", "ext"}, p.Fields())
+	assert.DeepEqual(t, []string{"category"}, p.OptionalFields())
+}
+
 func TestReplace(t *testing.T) {
 	for _, test := range []struct {
 		name        string
@@ -114,7 +144,7 @@ func TestReplace(t *testing.T) {
 			values: map[string]any{
 				"nonna": "888",
 			},
-			expected: "test {{tenant} sample 888",
+			expected: "test {tenant} sample 888",
 		},
 		{
 			name: "escape right",
@@ -124,6 +154,88 @@ func TestReplace(t *testing.T) {
 			},
 			expected: "test 666",
 		},
+		{
+			name:     "escape collapsed",
+			str:      "literal {{brace}} {tenant}",
+			values:   map[string]any{"tenant": "666"},
+			expected: "literal {brace} 666",
+		},
+		{
+			name:     "default",
+			str:      "{tenant}.{ext:-png}",
+			values:   map[string]any{"tenant": "666"},
+			expected: "666.png",
+		},
+		{
+			name:     "default empty",
+			str:      "{tenant}.{ext:-png|upper}",
+			values:   map[string]any{"tenant": "666", "ext": ""},
+			expected: "666.PNG",
+		},
+		{
+			name:     "default set",
+			str:      "{tenant}.{ext:-png}",
+			values:   map[string]any{"tenant": "666", "ext": "jpg"},
+			expected: "666.jpg",
+		},
+		{
+			name:     "optional",
+			str:      "images/{?{category}/}{tenant}.png",
+			values:   map[string]any{"tenant": "666", "category": "books"},
+			expected: "images/books/666.png",
+		},
+		{
+			name:     "optional missing",
+			str:      "images/{?{category}/}{tenant}.png",
+			values:   map[string]any{"tenant": "666"},
+			expected: "images/666.png",
+		},
+		{
+			name:     "optional nil",
+			str:      "images/{?{category}/{{x}}/}{tenant}.png",
+			values:   map[string]any{"tenant": "666", "category": nil},
+			expected: "images/666.png",
+		},
+		{
+			name:     "optional with default",
+			str:      "images/{?{category:-other}/}{tenant}.png",
+			values:   map[string]any{"tenant": "666"},
+			expected: "images/other/666.png",
+		},
+		{
+			name:     "optional ending with field",
+			str:      "images/photo{?-{variant}}.png",
+			values:   map[string]any{"variant": "small"},
+			expected: "images/photo-small.png",
+		},
+		{
+			name:     "optional ending with field missing",
+			str:      "images/photo{?-{variant}}.png",
+			values:   map[string]any{},
+			expected: "images/photo.png",
+		},
+		{
+			name:     "optional escape",
+			str:      "images/{?{category}/{{x}}/}{tenant}.png",
+			values:   map[string]any{"tenant": "666", "category": "books"},
+			expected: "images/books/{x}/666.png",
+		},
+		{
+			name: "repeated",
+			str:  "{value:tag_id}/{value:tag_id}.png",
+			values: map[string]any{
+				"value:tag_id": 559,
+			},
+			expected: "559/559.png",
+		},
+		{
+			name: "multibyte",
+			str:  "ação/{tenant}/ção",
+			values: map[string]any{
+				"tenant": "666",
+			},
+			expected: "ação/666/ção",
+		},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			p := ParseFields(test.str)
@@ -137,3 +249,135 @@ func TestReplace(t *testing.T) {
 		})
 	}
 }
+
+func TestParseFieldsStrict(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		str            string
+		expectedErr    error
+		expectedOffset int
+	}{
+		{
+			name: "valid",
+			str:  "test {{tenant}} {nonna} {?{category}/} {ext:-png}",
+		},
+		{
+			name: "optional ending with field",
+			str:  "photo{?-{value:variant}}.png",
+		},
+		{
+			name:           "not closed",
+			str:            "test {tenant} sample {nonna",
+			expectedErr:    ErrUnclosedField,
+			expectedOffset: 21,
+		},
+		{
+			name:           "empty",
+			str:            "test {} sample",
+			expectedErr:    ErrEmptyField,
+			expectedOffset: 5,
+		},
+		{
+			name:           "empty pipe",
+			str:            "test {tenant|} sample",
+			expectedErr:    ErrEmptyFieldFunc,
+			expectedOffset: 5,
+		},
+		{
+			name:           "unclosed optional",
+			str:            "test {?{tenant}/ sample",
+			expectedErr:    ErrUnclosedOptional,
+			expectedOffset: 5,
+		},
+		{
+			name:           "nested optional",
+			str:            "test {?{tenant}{?/} sample}",
+			expectedErr:    ErrNestedOptional,
+			expectedOffset: 15,
+		},
+		{
+			name:           "not open",
+			str:            "test tenant} sample {nonna}",
+			expectedErr:    ErrUnexpectedCloseBrace,
+			expectedOffset: 11,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseFieldsStrict(test.str)
+			if test.expectedErr == nil {
+				assert.NilError(t, err)
+				return
+			}
+			var parseErr *FieldsParseError
+			assert.Assert(t, errors.As(err, &parseErr))
+			assert.ErrorIs(t, err, test.expectedErr)
+			assert.Equal(t, test.expectedOffset, parseErr.Offset)
+		})
+	}
+}
+
+func TestReplaceSanitize(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		str         string
+		values      map[string]any
+		policy      SanitizePolicy
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "value",
+			str:      "images/{tenant}.png",
+			values:   map[string]any{"tenant": "a/b:c"},
+			expected: "images/a%2Fb%3Ac.png",
+		},
+		{
+			name:     "date pipe",
+			str:      "images/{t|date:2006/01/02}/{t|date:15:04}.png",
+			values:   map[string]any{"t": "2024-01-02T10:11:12Z"},
+			expected: "images/2024/01/02/10%3A11.png",
+		},
+		{
+			name:     "pipe",
+			str:      "images/{tenant|lower}.png",
+			values:   map[string]any{"tenant": "Acme/Evil"},
+			expected: "images/acme%2Fevil.png",
+		},
+		{
+			name:        "pipe reject",
+			str:         "images/{tenant|trim}.png",
+			values:      map[string]any{"tenant": "acme/evil"},
+			policy:      SanitizeReject,
+			expectedErr: ErrUnsafePathValue,
+		},
+		{
+			name:     "pipe separator argument",
+			str:      "images/{tenant|replace:-:/}.png",
+			values:   map[string]any{"tenant": "a-b"},
+			expected: "images/a%2Fb.png",
+		},
+		{
+			name:     "default",
+			str:      "images/{tenant:-a/b}.png",
+			values:   map[string]any{},
+			expected: "images/a/b.png",
+		},
+		{
+			name:     "number",
+			str:      "images/{id|printf:%.1f}.png",
+			values:   map[string]any{"id": 1.5},
+			expected: "images/1.5.png",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p := ParseFields(test.str)
+			pr, err := p.Replace(test.values, WithReplaceSanitize(test.policy, DefaultSanitizeMaxLength))
+			if test.expectedErr != nil {
+				assert.ErrorIs(t, err, test.expectedErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, test.expected, pr)
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package copyfile
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/rrgmc/debefix"
+)
+
+const (
+	fileAttributePrefix   = "file:"
+	sourceAttributePrefix = "source:"
+)
+
+// isFileAttributeField returns whether the field is a "file:" or "source:" placeholder.
+func isFileAttributeField(field string) bool {
+	return strings.HasPrefix(field, fileAttributePrefix) || strings.HasPrefix(field, sourceAttributePrefix)
+}
+
+// fileAttributes lazily loads the attributes of the source file of a !copyfile tag, used by the "file:" and
+// "source:" placeholders.
+// The same instance is used when resolving the field value and when copying the file, so inline, generated and
+// template contents are resolved only once, the first time they are needed.
+type fileAttributes struct {
+	c         *CopyFile
+	ctx       debefix.ValueResolveContext
+	fieldname string
+	fileData  FileData
+
+	m             sync.Mutex
+	sourceLoaded  bool
+	source        string
+	contentLoaded bool
+	content       []byte // resolved inline, generated or template content, nil for source files.
+	values        map[string]any
+}
+
+// getSource returns the resolved source path.
+func (a *fileAttributes) getSource() (string, error) {
+	if !a.sourceLoaded {
+		source, err := ReplaceFieldsWithFilter(a.fileData.Source, a.ctx,
+			WithReplaceSanitize(a.c.sanitizePolicy, a.c.sanitizeMaxLength))
+		if err != nil {
+			return "", err
+		}
+		a.source, a.sourceLoaded = source, true
+	}
+	return a.source, nil
+}
+
+// getContent returns the resolved content if the file doesn't come from a source file.
+func (a *fileAttributes) getContent() ([]byte, error) {
+	if !a.contentLoaded {
+		source, err := a.getSource()
+		if err != nil {
+			return nil, err
+		}
+		content, err := a.c.resolveContent(a.ctx, a.fieldname, a.fileData, source)
+		if err != nil {
+			return nil, err
+		}
+		a.content, a.contentLoaded = content, true
+	}
+	return a.content, nil
+}
+
+// loadedContent returns the resolved content if it was already loaded by a placeholder.
+func (a *fileAttributes) loadedContent() ([]byte, bool) {
+	a.m.Lock()
+	defer a.m.Unlock()
+	return a.content, a.contentLoaded && a.content != nil
+}
+
+// open opens the resolved content or the source file.
+func (a *fileAttributes) open() (io.ReadCloser, error) {
+	content, err := a.getContent()
+	if err != nil {
+		return nil, err
+	}
+	if content != nil {
+		return &bytesReadCloser{Reader: bytes.NewReader(content)}, nil
+	}
+	source, err := a.getSource()
+	if err != nil {
+		return nil, err
+	}
+	return a.c.openSource(source)
+}
+
+// value returns the value of a "file:" or "source:" placeholder.
+func (a *fileAttributes) value(field string) (any, error) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	if v, ok := a.values[field]; ok {
+		return v, nil
+	}
+
+	var err error
+	if name, ok := strings.CutPrefix(field, sourceAttributePrefix); ok {
+		err = a.loadSourceAttribute(name)
+	} else if name, ok := strings.CutPrefix(field, fileAttributePrefix); ok {
+		switch name {
+		case "size", "sha256", "md5":
+			err = a.loadHashes()
+		case "mimetype":
+			err = a.loadMimeType()
+		case "width", "height":
+			err = a.loadImageSize()
+		default:
+			err = fmt.Errorf("unknown file attribute '%s'", name)
+		}
+	} else {
+		err = fmt.Errorf("invalid file attribute field '%s'", field)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading '%s': %w", field, err)
+	}
+	return a.values[field], nil
+}
+
+func (a *fileAttributes) loadSourceAttribute(name string) error {
+	source, err := a.getSource()
+	if err != nil {
+		return err
+	}
+	if source == "" {
+		return fmt.Errorf("source attributes require a source file")
+	}
+	source = fsPath(source)
+	base := path.Base(source)
+	ext := path.Ext(base)
+
+	switch name {
+	case "basename":
+		a.values[sourceAttributePrefix+name] = base
+	case "dir":
+		a.values[sourceAttributePrefix+name] = path.Dir(source)
+	case "ext":
+		a.values[sourceAttributePrefix+name] = ext
+	case "stem":
+		a.values[sourceAttributePrefix+name] = strings.TrimSuffix(base, ext)
+	default:
+		return fmt.Errorf("unknown source attribute '%s'", name)
+	}
+	return nil
+}
+
+func (a *fileAttributes) loadHashes() error {
+	file, err := a.open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	sha256Hash, md5Hash := sha256.New(), md5.New()
+	size, err := io.Copy(io.MultiWriter(sha256Hash, md5Hash), file)
+	if err != nil {
+		return err
+	}
+	a.values[fileAttributePrefix+"size"] = size
+	a.values[fileAttributePrefix+"sha256"] = hex.EncodeToString(sha256Hash.Sum(nil))
+	a.values[fileAttributePrefix+"md5"] = hex.EncodeToString(md5Hash.Sum(nil))
+	return nil
+}
+
+// loadMimeType detects the MIME type from the source extension, or from the content if the extension is unknown.
+func (a *fileAttributes) loadMimeType() error {
+	source, err := a.getSource()
+	if err != nil {
+		return err
+	}
+	if ext := path.Ext(source); ext != "" {
+		if mimeType := mime.TypeByExtension(ext); mimeType != "" {
+			a.values[fileAttributePrefix+"mimetype"] = mimeType
+			return nil
+		}
+	}
+
+	file, err := a.open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	a.values[fileAttributePrefix+"mimetype"] = http.DetectContentType(buf[:n])
+	return nil
+}
+
+func (a *fileAttributes) loadImageSize() error {
+	file, err := a.open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return err
+	}
+	a.values[fileAttributePrefix+"width"] = config.Width
+	a.values[fileAttributePrefix+"height"] = config.Height
+	return nil
+}
+
+// getFileAttributes returns the attributes of the file of the row, creating them if needed.
+// They are kept until the row is resolved, see clearFileAttributes.
+func (c *CopyFile) getFileAttributes(ctx debefix.ValueResolveContext, fieldname string,
+	fileData FileData) *fileAttributes {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	rowKey := fileAttributesRowKey(ctx)
+	rowAttributes, ok := c.attributes[rowKey]
+	if !ok {
+		if c.attributes == nil {
+			c.attributes = map[string]map[string]*fileAttributes{}
+		}
+		rowAttributes = map[string]*fileAttributes{}
+		c.attributes[rowKey] = rowAttributes
+	}
+
+	key := fmt.Sprintf("%s\x00%s\x00%s\x00%s", fieldname, fileData.ID, fileData.Source, fileData.Destination)
+	if attributes, ok := rowAttributes[key]; ok {
+		// use the most recent context for the attributes not loaded yet, where more row fields are resolved.
+		attributes.m.Lock()
+		attributes.ctx = ctx
+		attributes.m.Unlock()
+		return attributes
+	}
+	attributes := &fileAttributes{
+		c:         c,
+		ctx:       ctx,
+		fieldname: fieldname,
+		fileData:  fileData,
+		values:    map[string]any{},
+	}
+	rowAttributes[key] = attributes
+	return attributes
+}
+
+// clearFileAttributes removes the file attributes of the row, so their contents can be garbage collected.
+// If ctx is nil, the attributes of all rows are removed.
+func (c *CopyFile) clearFileAttributes(ctx debefix.ValueResolveContext) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if ctx == nil {
+		c.attributes = nil
+		return
+	}
+	delete(c.attributes, fileAttributesRowKey(ctx))
+}
+
+// fileAttributesRowKey returns the key of the row in the file attributes cache.
+func fileAttributesRowKey(ctx debefix.ValueResolveContext) string {
+	return ctx.Table().ID + "\x00" + ctx.Row().InternalID.String()
+}
+
+// fileAttributesContext is implemented by resolve contexts which provide file attributes to
+// [ReplaceFieldsWithFilter].
+type fileAttributesContext interface {
+	fileAttributes() *fileAttributes
+}
+
+// fileResolveContext is a [debefix.ValueResolveContext] which provides file attributes.
+type fileResolveContext struct {
+	debefix.ValueResolveContext
+	attributes *fileAttributes
+}
+
+func (c *fileResolveContext) fileAttributes() *fileAttributes {
+	return c.attributes
+}
+
+// fileValueCallbackResolveContext is a [debefix.ValueCallbackResolveContext] which provides file attributes.
+type fileValueCallbackResolveContext struct {
+	debefix.ValueCallbackResolveContext
+	cf         *CopyFile
+	attributes *fileAttributes
+}
+
+func (c *fileValueCallbackResolveContext) fileAttributes() *fileAttributes {
+	return c.attributes
+}
+
+// withFileData returns a context which provides the attributes of another file of the same field.
+func (c *fileValueCallbackResolveContext) withFileData(fileData FileData) *fileValueCallbackResolveContext {
+	return &fileValueCallbackResolveContext{
+		ValueCallbackResolveContext: c.ValueCallbackResolveContext,
+		cf:                          c.cf,
+		attributes: c.cf.getFileAttributes(c.ValueCallbackResolveContext,
+			c.ValueCallbackResolveContext.FieldName(), fileData),
+	}
+}
@@ -0,0 +1,73 @@
+package copyfile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCopyFileFileAttributes(t *testing.T) {
+	const imageSHA256 = "e08f3abcd2003925730d6317067d23616dc11313d1e5a82f6ff74692f6c304e6"
+
+	destination := NewMemoryDestination()
+	resolvedData := resolveTestData(t, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tagfilename:
+          !copyfile
+          source: "images/javascript.png"
+          destination: "blobs/{file:sha256}{source:ext}"
+          value: "{file:sha256}|{file:size}|{file:md5}|{file:mimetype}|{source:basename}|{source:dir}|{source:stem}"
+`,
+		WithSourceFS(fstest.MapFS{
+			"images/javascript.png": &fstest.MapFile{Data: []byte("javascript image")},
+		}),
+		WithDestination(destination))
+
+	assert.Equal(t, imageSHA256+"|16|abdda93227e3535cecebff391dc11978|image/png|javascript.png|images|javascript",
+		resolvedData.Tables["tags"].Rows[0].Fields["tagfilename"])
+
+	content, err := fs.ReadFile(destination, "blobs/"+imageSHA256+".png")
+	assert.NilError(t, err)
+	assert.Equal(t, "javascript image", string(content))
+}
+
+func TestCopyFileFileAttributesGenerated(t *testing.T) {
+	destination := NewMemoryDestination()
+	c := New(WithDestination(destination))
+	resolvedData, err := resolveTestCopyFile(t, c, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        image:
+          !copyfile
+          generate: {name: random, size: 1KB}
+          destination: "blobs/{file:sha256}.bin"
+          value: "{file:sha256}"
+        thumbnail:
+          !copyfile
+          generate: {name: png, width: 64, height: 32}
+          destination: "thumbnails/{value:tag_id}.png"
+          value: "{file:width}x{file:height} {file:mimetype}"
+`)
+	assert.NilError(t, err)
+
+	fields := resolvedData.Tables["tags"].Rows[0].Fields
+	assert.Equal(t, "64x32 image/png", fields["thumbnail"])
+
+	// the content generated when resolving the value must be the copied one.
+	sha := fields["image"].(string)
+	content, err := fs.ReadFile(destination, "blobs/"+sha+".bin")
+	assert.NilError(t, err)
+	assert.Equal(t, 1024, len(content))
+	sum := sha256.Sum256(content)
+	assert.Equal(t, sha, hex.EncodeToString(sum[:]))
+
+	// the cached attributes must not be kept after the rows are resolved.
+	assert.Equal(t, 0, len(c.attributes))
+}
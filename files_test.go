@@ -0,0 +1,129 @@
+package copyfile
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCopyFileFiles(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		valueFrom     string
+		expectedValue any
+	}{
+		{
+			name:          "value list",
+			expectedValue: []any{"products/1/original.png", "products/1/thumbnail.png"},
+		},
+		{
+			name:          "value from",
+			valueFrom:     "value_from: thumbnail",
+			expectedValue: "products/1/thumbnail.png",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			destination := NewMemoryDestination()
+			c := New(
+				WithSourceFS(fstest.MapFS{
+					"images/product.png":       &fstest.MapFile{Data: []byte("product image")},
+					"images/product-thumb.png": &fstest.MapFile{Data: []byte("product thumbnail")},
+				}),
+				WithDestination(destination),
+			)
+
+			resolvedData, err := resolveTestCopyFile(t, c, `tables:
+  products:
+    rows:
+      - product_id: 1
+        gallery:
+          !copyfile
+          overwrite: error
+          `+test.valueFrom+`
+          files:
+            - id: original
+              source: "images/product.png"
+              destination: "products/{value:product_id}/original.png"
+              value: "products/{value:product_id}/original.png"
+            - id: thumbnail
+              source: "images/product-thumb.png"
+              destination: "products/{value:product_id}/thumbnail.png"
+              value: "products/{value:product_id}/thumbnail.png"
+            - id: preview
+              content: "preview of {value:product_id}"
+              destination: "products/{value:product_id}/preview.txt"
+`)
+			assert.NilError(t, err)
+
+			assert.DeepEqual(t, test.expectedValue, resolvedData.Tables["products"].Rows[0].Fields["gallery"])
+
+			for file, expected := range map[string]string{
+				"products/1/original.png":  "product image",
+				"products/1/thumbnail.png": "product thumbnail",
+				"products/1/preview.txt":   "preview of 1",
+			} {
+				content, err := fs.ReadFile(destination, file)
+				assert.NilError(t, err)
+				assert.Equal(t, expected, string(content))
+			}
+
+			manifest := c.Manifest()
+			assert.Equal(t, 3, len(manifest))
+			for i, id := range []string{"original", "thumbnail", "preview"} {
+				assert.Equal(t, "gallery", manifest[i].FieldName)
+				assert.Equal(t, id, manifest[i].FileID)
+			}
+		})
+	}
+}
+
+func TestCopyFileFilesInvalid(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		tag           string
+		expectedError string
+	}{
+		{
+			name: "source and files",
+			tag: `source: "images/product.png"
+          files:
+            - source: "images/product.png"
+              destination: "product.png"`,
+			expectedError: "source, content or generate cannot be set together with files",
+		},
+		{
+			name: "duplicated id",
+			tag: `files:
+            - id: original
+              source: "images/product.png"
+              destination: "product.png"
+            - id: original
+              source: "images/product.png"
+              destination: "product2.png"`,
+			expectedError: "duplicated files entry id 'original'",
+		},
+		{
+			name: "value from not found",
+			tag: `value_from: preview
+          files:
+            - id: original
+              source: "images/product.png"
+              destination: "product.png"`,
+			expectedError: "value_from files entry id 'preview' not found",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := resolveTestDataErr(t, `tables:
+  products:
+    rows:
+      - product_id: 1
+        gallery:
+          !copyfile
+          `+test.tag+`
+`, WithDestination(NewMemoryDestination()))
+			assert.ErrorContains(t, err, test.expectedError)
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package copyfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/rrgmc/debefix"
+	"golang.org/x/exp/maps"
+)
+
+// Generator generates file content, writing it to w.
+type Generator func(ctx GeneratorContext, w io.Writer) error
+
+// GeneratorContext is the information passed to a [Generator].
+type GeneratorContext struct {
+	TableID        string
+	RowID          string
+	FieldName      string
+	Params         map[string]any              // parameters from [FileData.Generate], including "name".
+	Rand           *rand.Rand                  // random generator seeded from the row and file, for reproducible output.
+	ResolveContext debefix.ValueResolveContext // debefix context of the resolved row.
+}
+
+const generatorNameParam = "name"
+
+// DefaultGenerators returns the built-in generators:
+//
+//   - png, jpeg, gif: solid-color image. Params: width, height (default 1), color (hex, default "#000").
+//   - random: random bytes. Params: size, an integer or a string with a B, KB, MB or GB suffix (default 1KB).
+//   - lorem: lorem ipsum text. Params: words (default 50).
+func DefaultGenerators() map[string]Generator {
+	return map[string]Generator{
+		"png":    generateImage("png"),
+		"jpeg":   generateImage("jpeg"),
+		"gif":    generateImage("gif"),
+		"random": generateRandom,
+		"lorem":  generateLorem,
+	}
+}
+
+// getGenerator returns the generator registered with WithGenerator or a built-in one.
+func (c *CopyFile) getGenerator(name string) (Generator, bool) {
+	if generator, ok := c.generators[name]; ok {
+		return generator, true
+	}
+	generator, ok := DefaultGenerators()[name]
+	return generator, ok
+}
+
+// generatorName returns the generator name from the [FileData.Generate] parameters.
+func generatorName(params map[string]any) (string, error) {
+	name, ok := params[generatorNameParam].(string)
+	if !ok || name == "" {
+		return "", fmt.Errorf("generator name is required")
+	}
+	return name, nil
+}
+
+// generateContent generates the file content using the generator set in [FileData.Generate].
+func (c *CopyFile) generateContent(ctx debefix.ValueResolveContext, fieldname string,
+	fileData FileData) ([]byte, error) {
+	name, err := generatorName(fileData.Generate)
+	if err != nil {
+		return nil, err
+	}
+	generator, ok := c.getGenerator(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown generator '%s'", name)
+	}
+
+	var buf bytes.Buffer
+	err = generator(GeneratorContext{
+		TableID:        ctx.Table().ID,
+		RowID:          rowID(ctx.Row()),
+		FieldName:      fieldname,
+		Params:         fileData.Generate,
+		Rand:           rand.New(rowRandSource(ctx, fieldname, fileData)),
+		ResolveContext: ctx,
+	}, &buf)
+	if err != nil {
+		return nil, fmt.Errorf("error generating content with '%s': %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// rowRandSource returns a random source seeded from the table, field, file entry, generator parameters and row
+// fields, so the same row always generates the same values, and different entries of the same field generate
+// different ones.
+// The row internal ID is not used as it changes on every load. Unresolved [debefix.Value] fields are not used, as
+// generation can happen while resolving the field values, and they contain pointers.
+func rowRandSource(ctx debefix.ValueResolveContext, fieldname string, fileData FileData) rand.Source {
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%s\x00%s\x00%s\x00%s\x00%s\x00%v\x00", ctx.Table().ID, fieldname,
+		ctx.Row().Config.RefID, fileData.ID, fileData.Destination, fileData.Generate)
+	fields := ctx.Row().Fields
+	names := maps.Keys(fields)
+	slices.Sort(names)
+	for _, name := range names {
+		if _, ok := fields[name].(debefix.Value); ok {
+			continue
+		}
+		_, _ = fmt.Fprintf(hash, "%s=%v\x00", name, fields[name])
+	}
+	sum := hash.Sum(nil)
+	return rand.NewPCG(binary.LittleEndian.Uint64(sum[:8]), binary.LittleEndian.Uint64(sum[8:16]))
+}
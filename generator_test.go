@@ -0,0 +1,168 @@
+package copyfile
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestGenerator(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		generate string
+		options  []Option
+		check    func(t *testing.T, content []byte)
+	}{
+		{
+			name:     "png",
+			generate: `{name: png, width: 64, height: 32, color: "#f00"}`,
+			check: func(t *testing.T, content []byte) {
+				img, format, err := image.Decode(bytes.NewReader(content))
+				assert.NilError(t, err)
+				assert.Equal(t, "png", format)
+				assert.Equal(t, image.Rect(0, 0, 64, 32), img.Bounds())
+				assert.Equal(t, color.NRGBAModel.Convert(img.At(10, 10)), color.Color(color.NRGBA{R: 255, A: 255}))
+			},
+		},
+		{
+			name:     "jpeg",
+			generate: `{name: jpeg, width: 16, height: 16, color: "#00ff00"}`,
+			check: func(t *testing.T, content []byte) {
+				img, format, err := image.Decode(bytes.NewReader(content))
+				assert.NilError(t, err)
+				assert.Equal(t, "jpeg", format)
+				assert.Equal(t, image.Rect(0, 0, 16, 16), img.Bounds())
+			},
+		},
+		{
+			name:     "gif",
+			generate: `{name: gif, width: 8, height: 4, color: "#00f"}`,
+			check: func(t *testing.T, content []byte) {
+				img, format, err := image.Decode(bytes.NewReader(content))
+				assert.NilError(t, err)
+				assert.Equal(t, "gif", format)
+				assert.Equal(t, image.Rect(0, 0, 8, 4), img.Bounds())
+				assert.Equal(t, color.NRGBAModel.Convert(img.At(1, 1)), color.Color(color.NRGBA{B: 255, A: 255}))
+			},
+		},
+		{
+			name:     "random",
+			generate: `{name: random, size: "2KB"}`,
+			check: func(t *testing.T, content []byte) {
+				assert.Equal(t, 2048, len(content))
+			},
+		},
+		{
+			name:     "lorem",
+			generate: `{name: lorem, words: 10}`,
+			check: func(t *testing.T, content []byte) {
+				assert.Assert(t, strings.HasPrefix(string(content), "Lorem ipsum "))
+				assert.Equal(t, 10, len(strings.Fields(string(content))))
+			},
+		},
+		{
+			name:     "custom",
+			generate: `{name: custom, text: "hello"}`,
+			options: []Option{
+				WithGenerator("custom", func(ctx GeneratorContext, w io.Writer) error {
+					_, err := fmt.Fprintf(w, "%s %s %v", ctx.Params["text"], ctx.FieldName, ctx.ResolveContext.Row().Fields["tag_id"])
+					return err
+				}),
+			},
+			check: func(t *testing.T, content []byte) {
+				assert.Equal(t, "hello tagfile 559", string(content))
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			// generate twice to check that the output is reproducible.
+			var contents [][]byte
+			for range 2 {
+				destination := NewMemoryDestination()
+				resolveTestData(t, fmt.Sprintf(`tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tagfile:
+          !copyfile
+          generate: %s
+          destination: "tags/{value:tag_id}.bin"
+`, test.generate), append([]Option{WithDestination(destination)}, test.options...)...)
+
+				content, err := fs.ReadFile(destination, "tags/559.bin")
+				assert.NilError(t, err)
+				test.check(t, content)
+				contents = append(contents, content)
+			}
+			assert.DeepEqual(t, contents[0], contents[1])
+		})
+	}
+}
+
+func TestGeneratorUnknown(t *testing.T) {
+	_, err := resolveTestDataErr(t, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tagfile:
+          !copyfile
+          generate: {name: unknown}
+          destination: "tags/{value:tag_id}.bin"
+`, WithDestination(NewMemoryDestination()))
+	assert.ErrorContains(t, err, "unknown generator 'unknown'")
+}
+
+func TestGeneratorFiles(t *testing.T) {
+	destination := NewMemoryDestination()
+	resolveTestData(t, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tagfile:
+          !copyfile
+          files:
+            - id: first
+              generate: {name: random, size: 64}
+              destination: "tags/{value:tag_id}/first.bin"
+            - id: second
+              generate: {name: random, size: 64}
+              destination: "tags/{value:tag_id}/second.bin"
+`, WithDestination(destination))
+
+	first, err := fs.ReadFile(destination, "tags/559/first.bin")
+	assert.NilError(t, err)
+	second, err := fs.ReadFile(destination, "tags/559/second.bin")
+	assert.NilError(t, err)
+	assert.Equal(t, 64, len(first))
+	assert.Assert(t, !bytes.Equal(first, second))
+}
+
+func TestGeneratorFileAttribute(t *testing.T) {
+	// the content is generated when resolving the value, it must be reproducible.
+	var values []any
+	for range 3 {
+		resolvedData := resolveTestData(t, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tagfile:
+          !copyfile
+          generate: {name: random, size: 64}
+          destination: "tags/{file:sha256}.bin"
+          value: "{file:sha256}"
+`, WithDestination(NewMemoryDestination()))
+		values = append(values, resolvedData.Tables["tags"].Rows[0].Fields["tagfile"])
+	}
+	assert.Equal(t, values[0], values[1])
+	assert.Equal(t, values[0], values[2])
+}
@@ -0,0 +1,206 @@
+package copyfile
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// generateImage returns a generator of solid-color images in the format.
+func generateImage(format string) Generator {
+	return func(ctx GeneratorContext, w io.Writer) error {
+		width, err := paramInt(ctx.Params, "width", 1)
+		if err != nil {
+			return err
+		}
+		height, err := paramInt(ctx.Params, "height", 1)
+		if err != nil {
+			return err
+		}
+		if width < 1 || height < 1 {
+			return fmt.Errorf("invalid image size %dx%d", width, height)
+		}
+		colorStr, err := paramString(ctx.Params, "color", "#000")
+		if err != nil {
+			return err
+		}
+		fill, err := parseHexColor(colorStr)
+		if err != nil {
+			return err
+		}
+
+		rect := image.Rect(0, 0, int(width), int(height))
+		if format == "gif" {
+			img := image.NewPaletted(rect, color.Palette{fill})
+			return gif.Encode(w, img, nil)
+		}
+
+		img := image.NewNRGBA(rect)
+		for i := 0; i < len(img.Pix); i += 4 {
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = fill.R, fill.G, fill.B, fill.A
+		}
+		if format == "jpeg" {
+			quality, err := paramInt(ctx.Params, "quality", jpeg.DefaultQuality)
+			if err != nil {
+				return err
+			}
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: int(quality)})
+		}
+		return png.Encode(w, img)
+	}
+}
+
+// generateRandom generates random bytes.
+func generateRandom(ctx GeneratorContext, w io.Writer) error {
+	size, err := paramSize(ctx.Params, "size", 1024)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 32*1024)
+	for size > 0 {
+		n := min(size, int64(len(buf)))
+		for i := int64(0); i < n; i++ {
+			buf[i] = byte(ctx.Rand.Uint32())
+		}
+		if _, err = w.Write(buf[:n]); err != nil {
+			return err
+		}
+		size -= n
+	}
+	return nil
+}
+
+var loremWords = strings.Fields(`lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor
+incididunt ut labore et dolore magna aliqua ut enim ad minim veniam quis nostrud exercitation ullamco laboris nisi
+ut aliquip ex ea commodo consequat duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu
+fugiat nulla pariatur excepteur sint occaecat cupidatat non proident sunt in culpa qui officia deserunt mollit anim
+id est laborum`)
+
+// generateLorem generates lorem ipsum text, starting with "Lorem ipsum" and followed by random words.
+func generateLorem(ctx GeneratorContext, w io.Writer) error {
+	words, err := paramInt(ctx.Params, "words", 50)
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	for i := int64(0); i < words; i++ {
+		word := loremWords[ctx.Rand.IntN(len(loremWords))]
+		if i < 2 {
+			word = loremWords[i]
+		}
+		if i == 0 {
+			word = strings.ToUpper(word[:1]) + word[1:]
+		} else {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(word)
+	}
+	if words > 0 {
+		sb.WriteString(".\n")
+	}
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+// paramInt returns an integer parameter, or the default value if not set.
+func paramInt(params map[string]any, name string, defaultValue int64) (int64, error) {
+	value, ok := params[name]
+	if !ok {
+		return defaultValue, nil
+	}
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint64:
+		return int64(v), nil
+	case float64:
+		return int64(v), nil
+	case string:
+		ret, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid integer parameter '%s': %w", name, err)
+		}
+		return ret, nil
+	default:
+		return 0, fmt.Errorf("invalid integer parameter '%s' of type %T", name, value)
+	}
+}
+
+// paramString returns a string parameter, or the default value if not set.
+func paramString(params map[string]any, name string, defaultValue string) (string, error) {
+	value, ok := params[name]
+	if !ok {
+		return defaultValue, nil
+	}
+	if v, ok := value.(string); ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("invalid string parameter '%s' of type %T", name, value)
+}
+
+// paramSize returns a size parameter, an integer or a string with a B, KB, MB or GB suffix.
+func paramSize(params map[string]any, name string, defaultValue int64) (int64, error) {
+	value, ok := params[name].(string)
+	if !ok {
+		return paramInt(params, name, defaultValue)
+	}
+
+	str := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	} {
+		if s, ok := strings.CutSuffix(str, unit.suffix); ok {
+			str, multiplier = strings.TrimSpace(s), unit.multiplier
+			break
+		}
+	}
+	size, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size parameter '%s': %s", name, value)
+	}
+	return size * multiplier, nil
+}
+
+// parseHexColor parses a color in the #rgb, #rgba, #rrggbb or #rrggbbaa formats.
+func parseHexColor(str string) (color.NRGBA, error) {
+	hex, ok := strings.CutPrefix(str, "#")
+	if !ok {
+		return color.NRGBA{}, fmt.Errorf("invalid color '%s': must start with '#'", str)
+	}
+	if len(hex) == 3 || len(hex) == 4 {
+		var sb strings.Builder
+		for _, ch := range hex {
+			sb.WriteRune(ch)
+			sb.WriteRune(ch)
+		}
+		hex = sb.String()
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color '%s'", str)
+	}
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color '%s': %w", str, err)
+	}
+	return color.NRGBA{R: uint8(value >> 24), G: uint8(value >> 16), B: uint8(value >> 8), A: uint8(value)}, nil
+}
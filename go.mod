@@ -10,6 +10,8 @@ require (
 	github.com/google/go-cmp v0.6.0
 	github.com/rrgmc/debefix v1.3.5
 	golang.org/x/exp v0.0.0-20240613232115-7f521ea00fb8
+	golang.org/x/sys v0.6.0
+	golang.org/x/text v0.14.0
 	gotest.tools/v3 v3.5.1
 )
 
@@ -18,6 +20,5 @@ require (
 	github.com/google/uuid v1.3.1 // indirect
 	github.com/mattn/go-colorable v0.1.8 // indirect
 	github.com/mattn/go-isatty v0.0.12 // indirect
-	golang.org/x/sys v0.6.0 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 )
@@ -0,0 +1,79 @@
+package copyfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+)
+
+// LinkMode sets how the destination file is created from the source file.
+type LinkMode string
+
+const (
+	LinkCopy     LinkMode = "copy"     // copy the file contents.
+	LinkSymlink  LinkMode = "symlink"  // create a symbolic link to the source file.
+	LinkHardlink LinkMode = "hardlink" // create a hard link to the source file.
+	LinkReflink  LinkMode = "reflink"  // create a copy-on-write clone of the source file.
+)
+
+// IsValid returns whether the mode is a known one. A blank mode is valid, and means the default one.
+func (m LinkMode) IsValid() bool {
+	switch m {
+	case "", LinkCopy, LinkSymlink, LinkHardlink, LinkReflink:
+		return true
+	default:
+		return false
+	}
+}
+
+// linkDestinationFile creates the destination file as a link to the OS source file, creating the directories if
+// needed. The link is created with a temporary name and renamed to the destination filename, replacing it if
+// it exists. It returns an error wrapping [errors.ErrUnsupported] if the destination doesn't support the link mode.
+func linkDestinationFile(mode LinkMode, sourceFilename string, destination Destination,
+	destinationFilename string) error {
+	linkDestination, ok := destination.(LinkDestination)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+
+	var link func(oldname, newname string) error
+	switch mode {
+	case LinkSymlink:
+		link = linkDestination.Symlink
+	case LinkHardlink:
+		link = linkDestination.Link
+	case LinkReflink:
+		link = linkDestination.Reflink
+	default:
+		return fmt.Errorf("invalid link mode '%s'", mode)
+	}
+
+	err := destination.MkdirAll(path.Dir(destinationFilename), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	tempName, err := tryTempName(path.Dir(destinationFilename), "."+path.Base(destinationFilename)+".*.tmp",
+		func(name string) error {
+			return link(sourceFilename, name)
+		})
+	if err != nil {
+		return err
+	}
+	if err = destination.Rename(tempName, destinationFilename); err != nil {
+		return errors.Join(err, destination.Remove(tempName))
+	}
+	return nil
+}
+
+// getLinkMode returns the link mode of the file, or the global one if not set.
+func (c *CopyFile) getLinkMode(fileData FileData) LinkMode {
+	if fileData.Mode != "" {
+		return fileData.Mode
+	}
+	if c.linkMode != "" {
+		return c.linkMode
+	}
+	return LinkCopy
+}
@@ -0,0 +1,113 @@
+package copyfile
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestLinkMode(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		mode         LinkMode
+		tagMode      LinkMode
+		memory       bool
+		expectedMode LinkMode
+		check        func(t *testing.T, sourceFile, destinationFile string)
+	}{
+		{
+			name:         "copy",
+			mode:         LinkCopy,
+			expectedMode: LinkCopy,
+		},
+		{
+			name:         "symlink",
+			mode:         LinkSymlink,
+			expectedMode: LinkSymlink,
+			check: func(t *testing.T, sourceFile, destinationFile string) {
+				target, err := os.Readlink(destinationFile)
+				assert.NilError(t, err)
+				assert.Equal(t, sourceFile, target)
+			},
+		},
+		{
+			name:         "hardlink",
+			mode:         LinkHardlink,
+			expectedMode: LinkHardlink,
+			check: func(t *testing.T, sourceFile, destinationFile string) {
+				sourceStat, err := os.Stat(sourceFile)
+				assert.NilError(t, err)
+				destinationStat, err := os.Lstat(destinationFile)
+				assert.NilError(t, err)
+				assert.Assert(t, os.SameFile(sourceStat, destinationStat))
+			},
+		},
+		{
+			name:         "tag override",
+			mode:         LinkCopy,
+			tagMode:      LinkSymlink,
+			expectedMode: LinkSymlink,
+			check: func(t *testing.T, sourceFile, destinationFile string) {
+				stat, err := os.Lstat(destinationFile)
+				assert.NilError(t, err)
+				assert.Assert(t, stat.Mode()&fs.ModeSymlink != 0)
+			},
+		},
+		{
+			name:         "fallback to copy",
+			mode:         LinkSymlink,
+			memory:       true,
+			expectedMode: LinkCopy,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sourcePath := t.TempDir()
+			destinationPath := t.TempDir()
+			assert.NilError(t, os.MkdirAll(filepath.Join(sourcePath, "images"), 0o755))
+			assert.NilError(t, os.WriteFile(filepath.Join(sourcePath, "images", "javascript.png"),
+				[]byte("javascript image"), 0o644))
+
+			options := []Option{
+				WithSourcePath(sourcePath),
+				WithLinkMode(test.mode),
+			}
+			var destination Destination = NewOSDestination(destinationPath)
+			if test.memory {
+				destination = NewMemoryDestination()
+			}
+			options = append(options, WithDestination(destination))
+
+			c := New(options...)
+			_, err := resolveTestCopyFile(t, c, fmt.Sprintf(`tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tag_name: "javascript"
+        tagfilename:
+          !copyfile
+          source: "images/{value:tag_name}.png"
+          destination: "images/{value:tag_id}.png"
+          mode: "%s"
+`, test.tagMode))
+			assert.NilError(t, err)
+
+			content, err := fs.ReadFile(destination, "images/559.png")
+			assert.NilError(t, err)
+			assert.Equal(t, "javascript image", string(content))
+
+			manifest := c.Manifest()
+			assert.Equal(t, 1, len(manifest))
+			assert.Equal(t, test.expectedMode, manifest[0].Mode)
+			assert.Equal(t, int64(16), manifest[0].Size)
+
+			if test.check != nil {
+				test.check(t, filepath.Join(sourcePath, "images", "javascript.png"),
+					filepath.Join(destinationPath, "images", "559.png"))
+			}
+		})
+	}
+}
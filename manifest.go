@@ -0,0 +1,83 @@
+package copyfile
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ManifestEntry is the record of a file operation performed during resolve.
+// Size, SHA256 and Mode are only available when the file is written by [CopyFile.Copy], and SHA256 is not
+// calculated for links.
+type ManifestEntry struct {
+	TableID     string        `json:"table_id"`
+	RowID       string        `json:"row_id"`
+	FieldName   string        `json:"field_name"`
+	FileID      string        `json:"file_id,omitempty"` // id of the files entry, if the tag has a list of files.
+	Source      string        `json:"source"`
+	Destination string        `json:"destination"`
+	Size        int64         `json:"size"`
+	SHA256      string        `json:"sha256,omitempty"`
+	Mode        LinkMode      `json:"mode,omitempty"`    // how the file was created, after any fallback to copy.
+	Skipped     bool          `json:"skipped,omitempty"` // file was not written because of the overwrite policy.
+	Duration    time.Duration `json:"duration"`
+}
+
+// Manifest returns the list of file operations performed, in the order they finished.
+func (c *CopyFile) Manifest() []ManifestEntry {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return slices.Clone(c.manifest)
+}
+
+// WriteManifestJSON writes the manifest as a JSON array.
+func (c *CopyFile) WriteManifestJSON(w io.Writer) error {
+	manifest := c.Manifest()
+	if manifest == nil {
+		manifest = []ManifestEntry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(manifest)
+}
+
+// WriteManifestJSONL writes the manifest as JSON Lines, one entry per line.
+func (c *CopyFile) WriteManifestJSONL(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, entry := range c.Manifest() {
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CopyFile) addManifestEntries(entries ...ManifestEntry) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.manifest = append(c.manifest, entries...)
+}
+
+// manifestRecorder collects the manifest entries of a single CopyFileContextCallback call.
+type manifestRecorder struct {
+	m       sync.Mutex
+	entries []ManifestEntry
+}
+
+func (r *manifestRecorder) add(entry ManifestEntry) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.entries = append(r.entries, entry)
+}
+
+type manifestRecorderKey struct{}
+
+// recordManifestEntry adds the entry to the manifest recorder of the context, if available.
+func recordManifestEntry(ctx context.Context, entry ManifestEntry) {
+	if r, ok := ctx.Value(manifestRecorderKey{}).(*manifestRecorder); ok {
+		r.add(entry)
+	}
+}
@@ -0,0 +1,67 @@
+package copyfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestManifest(t *testing.T) {
+	c := New(
+		WithSourceFS(fstest.MapFS{
+			"images/javascript.png": &fstest.MapFile{Data: []byte("javascript image")},
+			"images/golang.png":     &fstest.MapFile{Data: []byte("golang image")},
+		}),
+		WithDestination(NewMemoryDestination()),
+	)
+
+	_, err := resolveTestCopyFile(t, c, `tables:
+  tags:
+    config:
+      default_values:
+        tagfilename:
+          !copyfile
+          source: "images/{value:tag_name}.png"
+          destination: "images/{value:tag_id}.png"
+    rows:
+      - tag_id: 559
+        tag_name: "javascript"
+        _refid: !refid "tag_javascript"
+      - tag_id: 560
+        tag_name: "golang"
+        _refid: !refid "tag_golang"
+`)
+	assert.NilError(t, err)
+
+	manifest := c.Manifest()
+	assert.Equal(t, 2, len(manifest))
+
+	assert.Equal(t, "tags", manifest[0].TableID)
+	assert.Equal(t, "tag_javascript", manifest[0].RowID)
+	assert.Equal(t, "tagfilename", manifest[0].FieldName)
+	assert.Equal(t, "images/javascript.png", manifest[0].Source)
+	assert.Equal(t, "images/559.png", manifest[0].Destination)
+	assert.Equal(t, int64(16), manifest[0].Size)
+	assert.Equal(t, "e08f3abcd2003925730d6317067d23616dc11313d1e5a82f6ff74692f6c304e6", manifest[0].SHA256)
+	assert.Equal(t, "tag_golang", manifest[1].RowID)
+	assert.Equal(t, "images/560.png", manifest[1].Destination)
+	assert.Equal(t, int64(12), manifest[1].Size)
+
+	var jsonBuf bytes.Buffer
+	assert.NilError(t, c.WriteManifestJSON(&jsonBuf))
+	var jsonManifest []ManifestEntry
+	assert.NilError(t, json.Unmarshal(jsonBuf.Bytes(), &jsonManifest))
+	assert.DeepEqual(t, manifest, jsonManifest)
+
+	var jsonlBuf bytes.Buffer
+	assert.NilError(t, c.WriteManifestJSONL(&jsonlBuf))
+	lines := strings.Split(strings.TrimSpace(jsonlBuf.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	var jsonlEntry ManifestEntry
+	assert.NilError(t, json.Unmarshal([]byte(lines[1]), &jsonlEntry))
+	assert.DeepEqual(t, manifest[1], jsonlEntry)
+}
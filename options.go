@@ -1,6 +1,11 @@
 package copyfile
 
-import "github.com/rrgmc/debefix"
+import (
+	"context"
+	"io/fs"
+
+	"github.com/rrgmc/debefix"
+)
 
 // GetPathsCallback gets the source and destination file names from [FileData].
 type GetPathsCallback func(ctx debefix.ValueResolveContext, fieldname string,
@@ -14,8 +19,21 @@ type GetValueCallback func(ctx debefix.ValueCallbackResolveContext,
 // CopyFileCallback copy a file from a source to a destination.
 type CopyFileCallback func(sourcePath, sourceFilename string, destinationPath, destinationFilename string) error
 
+// CopyFileFSCallback copy a file from a source filesystem to a destination.
+type CopyFileFSCallback func(sourceFS fs.FS, sourceFilename string, destinationPath, destinationFilename string) error
+
+// CopyFileContextCallback copy a file using the file information. The default implementation is [CopyFile.Copy].
+type CopyFileContextCallback func(ctx context.Context, info CopyFileInfo) error
+
 type Option func(*CopyFile)
 
+// WithContext sets the context passed to CopyFileContextCallback. Cancelling it cancels the file copies.
+func WithContext(ctx context.Context) Option {
+	return func(c *CopyFile) {
+		c.ctx = ctx
+	}
+}
+
 // WithSourcePath sets the source path, the root of all source filenames.
 func WithSourcePath(sourcePath string) Option {
 	return func(c *CopyFile) {
@@ -23,6 +41,14 @@ func WithSourcePath(sourcePath string) Option {
 	}
 }
 
+// WithSourceFS sets the source filesystem, the root of all source filenames. It takes precedence over
+// WithSourcePath, and source filenames are read using CopyFileFSCallback instead of CopyFileCallback.
+func WithSourceFS(sourceFS fs.FS) Option {
+	return func(c *CopyFile) {
+		c.sourceFS = sourceFS
+	}
+}
+
 // WithDestinationPath sets the destination path, the root of all destination filenames.
 func WithDestinationPath(destinationPath string) Option {
 	return func(c *CopyFile) {
@@ -30,6 +56,14 @@ func WithDestinationPath(destinationPath string) Option {
 	}
 }
 
+// WithDestination sets the destination where files are written to. It takes precedence over WithDestinationPath,
+// and is used only when no custom CopyFileCallback or CopyFileFSCallback is set.
+func WithDestination(destination Destination) Option {
+	return func(c *CopyFile) {
+		c.destination = destination
+	}
+}
+
 // WithGetPathsCallback sets the callback to get the source and destination filenames from the FileData parameters.
 // The default implementation DefaultGetPathsCallback replaces field filters in both source and destination using
 // ReplaceFieldsWithFilter.
@@ -49,8 +83,132 @@ func WithGetValueCallback(setValueCallback GetValueCallback) Option {
 }
 
 // WithCopyFileCallback sets the callback that copy files from a source to a destination.
+// It is only used if no source filesystem was set using WithSourceFS, and is ignored if
+// WithCopyFileContextCallback is set. Files with resolved contents, like the ones set by [FileData.Content], are
+// written to the destination by [CopyFile.Copy] instead.
 func WithCopyFileCallback(callback CopyFileCallback) Option {
 	return func(c *CopyFile) {
 		c.copyFileCallback = callback
 	}
 }
+
+// WithCopyFileFSCallback sets the callback that copy files from a source filesystem to a destination.
+// It is only used if a source filesystem was set using WithSourceFS, and is ignored if
+// WithCopyFileContextCallback is set. Files with resolved contents, like the ones set by [FileData.Content], are
+// written to the destination by [CopyFile.Copy] instead.
+func WithCopyFileFSCallback(callback CopyFileFSCallback) Option {
+	return func(c *CopyFile) {
+		c.copyFileFSCallback = callback
+	}
+}
+
+// WithCopyFileContextCallback sets the callback that copy files, receiving the context and the file information.
+// The default implementation is [CopyFile.Copy], which can be called by the callback.
+func WithCopyFileContextCallback(callback CopyFileContextCallback) Option {
+	return func(c *CopyFile) {
+		c.copyFileContextCallback = callback
+	}
+}
+
+// WithAllowPathEscape disables the check that resolved source and destination paths must be contained in their
+// root directories, and that the destination must not be inside the source root directory.
+func WithAllowPathEscape() Option {
+	return func(c *CopyFile) {
+		c.allowPathEscape = true
+	}
+}
+
+// WithOverwritePolicy sets what to do when a destination file already exists. The default is OverwriteAlways.
+// It can be overridden per file using [FileData.Overwrite].
+// With WithCopyFileCallback or WithCopyFileFSCallback, the policy is applied before calling the callback, which is
+// only called if the destination must be written.
+func WithOverwritePolicy(policy OverwritePolicy) Option {
+	return func(c *CopyFile) {
+		c.overwritePolicy = policy
+	}
+}
+
+// WithDryRun resolves the file paths without reading or writing any file. The planned copies are available in
+// [CopyFile.Plan].
+func WithDryRun() Option {
+	return func(c *CopyFile) {
+		c.dryRun = true
+	}
+}
+
+// WithTransaction records all files and directories created in the destination, and backs up the overwritten files.
+// If copying fails, or [CopyFile.Rollback] is called, the destination is restored to its previous state.
+// [CopyFile.Commit] must be called after a successful resolve to remove the backups.
+// Only files written using the destination are recorded, custom copy callbacks must handle this themselves.
+func WithTransaction() Option {
+	return func(c *CopyFile) {
+		c.isTransaction = true
+	}
+}
+
+// WithDeferred only queues the file copies when rows are resolved. They are executed by [CopyFile.Flush], or at the
+// end of [CopyFile.Resolve], using the passed number of parallel workers. If workers is less than 1, the number of
+// CPUs is used. Queued copies with the same destination are deduplicated, the last one is used.
+func WithDeferred(workers int) Option {
+	return func(c *CopyFile) {
+		c.isDeferred = true
+		c.workers = workers
+	}
+}
+
+// WithVerifyDestination re-reads each written destination file and checks that its SHA-256 matches the written
+// contents, returning a [ChecksumError] if it doesn't.
+func WithVerifyDestination() Option {
+	return func(c *CopyFile) {
+		c.verifyDestination = true
+	}
+}
+
+// WithLinkMode sets how destination files are created from source files. The default is LinkCopy.
+// It can be overridden per file using [FileData.Mode].
+// Links are only possible when using WithSourcePath and a destination implementing [LinkDestination], like the one
+// set by WithDestinationPath. When the link can't be created, the file is copied instead.
+func WithLinkMode(mode LinkMode) Option {
+	return func(c *CopyFile) {
+		c.linkMode = mode
+	}
+}
+
+// WithFieldFunc registers a function to be used in field pipes, like "{value:name|myfunc}", overriding any built-in
+// function with the same name. See DefaultFieldFuncs for the built-in ones.
+func WithFieldFunc(name string, fn FieldFunc) Option {
+	return func(c *CopyFile) {
+		if c.fieldFuncs == nil {
+			c.fieldFuncs = map[string]FieldFunc{}
+		}
+		c.fieldFuncs[name] = fn
+	}
+}
+
+// WithSanitizePolicy sets how the values substituted into the source and destination path templates by
+// DefaultGetPathsCallback are made filesystem-safe. The default is DefaultSanitizePolicy. The value template is
+// never sanitized.
+func WithSanitizePolicy(policy SanitizePolicy) Option {
+	return func(c *CopyFile) {
+		c.sanitizePolicy = policy
+	}
+}
+
+// WithSanitizeMaxLength sets the maximum length in bytes of each sanitized path value. The default is
+// DefaultSanitizeMaxLength, and a value <= 0 means no limit.
+func WithSanitizeMaxLength(maxLength int) Option {
+	return func(c *CopyFile) {
+		c.sanitizeMaxLength = maxLength
+	}
+}
+
+// WithGenerator registers a generator to be used by [FileData.Generate], overriding any built-in generator with the
+// same name. See DefaultGenerators for the built-in ones.
+func WithGenerator(name string, generator Generator) Option {
+	return func(c *CopyFile) {
+		if c.generators == nil {
+			c.generators = map[string]Generator{}
+		}
+		c.generators[name] = generator
+	}
+}
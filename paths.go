@@ -0,0 +1,66 @@
+package copyfile
+
+import (
+	"path/filepath"
+
+	"github.com/rrgmc/debefix"
+)
+
+// checkPaths checks if the resolved source and destination paths are contained in their root directories,
+// and that the destination is not inside the source root directory.
+func (c *CopyFile) checkPaths(ctx debefix.ValueResolveContext, fieldname string, source, destination string) error {
+	if c.allowPathEscape {
+		return nil
+	}
+
+	newError := func(path string, err error) error {
+		return &PathEscapeError{
+			TableID:   ctx.Table().ID,
+			RowID:     rowID(ctx.Row()),
+			FieldName: fieldname,
+			Path:      path,
+			Err:       err,
+		}
+	}
+
+	if source != "" && !isLocalPath(source) {
+		return newError(source, ErrPathEscapesRoot)
+	}
+	if !isLocalPath(destination) {
+		return newError(destination, ErrPathEscapesRoot)
+	}
+
+	if c.sourcePath != "" && c.destinationPath != "" {
+		inside, err := isInsidePath(c.sourcePath, filepath.Join(c.destinationPath, destination))
+		if err != nil {
+			return err
+		}
+		if inside {
+			return newError(destination, ErrDestinationInsideSource)
+		}
+	}
+
+	return nil
+}
+
+// isLocalPath returns whether the slash or OS-separated path is lexically contained in its root.
+func isLocalPath(path string) bool {
+	return filepath.IsLocal(filepath.FromSlash(path))
+}
+
+// isInsidePath returns whether path is the root path or is inside it.
+func isInsidePath(root, path string) (bool, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return false, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(absRoot, absPath)
+	if err != nil {
+		return false, nil
+	}
+	return rel == "." || filepath.IsLocal(rel), nil
+}
@@ -0,0 +1,135 @@
+package copyfile
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// PlanAction is the action that would be performed on a destination file.
+type PlanAction string
+
+const (
+	PlanCreate    PlanAction = "create"    // the destination file doesn't exist and would be created.
+	PlanOverwrite PlanAction = "overwrite" // the destination file exists and would be overwritten.
+	PlanSkip      PlanAction = "skip"      // the destination file exists and would be kept.
+	PlanError     PlanAction = "error"     // the destination file exists and the overwrite policy returns an error.
+)
+
+// PlannedCopy is a file copy planned in dry-run mode.
+type PlannedCopy struct {
+	TableID           string
+	RowID             string
+	FieldName         string
+	Source            string
+	Destination       string
+	SourceExists      bool
+	DestinationAction PlanAction
+}
+
+// Plan returns the list of planned copies in dry-run mode, in resolve order.
+func (c *CopyFile) Plan() []PlannedCopy {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return slices.Clone(c.plan)
+}
+
+// planCopy adds the file copy to the plan, checking the existence of the source and destination files.
+func (c *CopyFile) planCopy(info CopyFileInfo) error {
+	// inline, generated and archive contents are not read in dry-run mode.
+	sourceExists := info.Content != nil || info.archiveEntry != nil || info.FileData.Content != nil ||
+		info.FileData.Generate != nil
+	if !sourceExists {
+		var err error
+		sourceExists, err = c.sourceExists(info.Source)
+		if err != nil {
+			return err
+		}
+	}
+	action, err := c.planDestinationAction(info)
+	if err != nil {
+		return err
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.plan = append(c.plan, PlannedCopy{
+		TableID:           info.TableID,
+		RowID:             info.RowID,
+		FieldName:         info.FieldName,
+		Source:            info.Source,
+		Destination:       info.Destination,
+		SourceExists:      sourceExists,
+		DestinationAction: action,
+	})
+	return nil
+}
+
+// sourceExists returns whether the source file exists.
+func (c *CopyFile) sourceExists(source string) (bool, error) {
+	var err error
+	if c.sourceFS != nil {
+		_, err = fs.Stat(c.sourceFS, fsPath(source))
+	} else if c.sourcePath != "" {
+		_, err = os.Stat(filepath.Join(c.sourcePath, source))
+	} else {
+		return false, errors.New("source path or filesystem is required")
+	}
+	return existsResult(err)
+}
+
+// planDestinationAction returns the action that would be performed on the destination file.
+func (c *CopyFile) planDestinationAction(info CopyFileInfo) (PlanAction, error) {
+	if c.destination == nil {
+		return PlanCreate, nil
+	}
+	destination := fsPath(info.Destination)
+	stat, err := c.destination.Stat(destination)
+	if exists, err := existsResult(err); err != nil || !exists {
+		return PlanCreate, err
+	}
+
+	switch c.getOverwritePolicy(info.FileData) {
+	case OverwriteError:
+		return PlanError, nil
+	case OverwriteSkip:
+		return PlanSkip, nil
+	case OverwriteIfDifferent:
+		if info.Content == nil && (info.FileData.Content != nil || info.FileData.Generate != nil ||
+			info.FileData.Template || info.archiveEntry != nil) {
+			// the content is not resolved in dry-run mode, so it can't be compared.
+			return PlanOverwrite, nil
+		}
+		sourceFile, _, err := c.openFileSource(info)
+		if errors.Is(err, fs.ErrNotExist) {
+			return PlanOverwrite, nil
+		} else if err != nil {
+			return "", err
+		}
+		defer sourceFile.Close()
+		_, equal, err := compareDestinationFile(sourceFile, c.destination, destination, stat.Size())
+		if err != nil {
+			return "", err
+		}
+		if equal {
+			return PlanSkip, nil
+		}
+		return PlanOverwrite, nil
+	default:
+		return PlanOverwrite, nil
+	}
+}
+
+// existsResult converts a stat error to a file existence result.
+func existsResult(err error) (bool, error) {
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, fs.ErrNotExist):
+		return false, nil
+	default:
+		return false, err
+	}
+}
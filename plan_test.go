@@ -0,0 +1,130 @@
+package copyfile
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestPlan(t *testing.T) {
+	destination := NewMemoryDestination()
+	assert.NilError(t, destination.MkdirAll("images", 0o755))
+	f, err := destination.Create("images/559.png")
+	assert.NilError(t, err)
+	assert.NilError(t, f.Close())
+
+	c := New(
+		WithDryRun(),
+		WithSourceFS(fstest.MapFS{
+			"images/javascript.png": &fstest.MapFile{Data: []byte("javascript image")},
+		}),
+		WithDestination(destination),
+	)
+
+	resolvedData, err := resolveTestCopyFile(t, c, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tag_name: "javascript"
+        _refid: !refid "tag_javascript"
+        tagfilename:
+          !copyfile
+          value: "{value:tag_id}.png"
+          source: "images/{value:tag_name}.png"
+          destination: "images/{value:tag_id}.png"
+        tagthumbnail:
+          !copyfile
+          source: "images/{value:tag_name}_thumb.png"
+          destination: "images/{value:tag_id}_thumb.png"
+        tagbackup:
+          !copyfile
+          source: "images/{value:tag_name}.png"
+          destination: "images/{value:tag_id}.png"
+          overwrite: skip
+`)
+	assert.NilError(t, err)
+	assert.Equal(t, "559.png", resolvedData.Tables["tags"].Rows[0].Fields["tagfilename"])
+
+	assert.DeepEqual(t, []PlannedCopy{
+		{
+			TableID:           "tags",
+			RowID:             "tag_javascript",
+			FieldName:         "tagbackup",
+			Source:            "images/javascript.png",
+			Destination:       "images/559.png",
+			SourceExists:      true,
+			DestinationAction: PlanSkip,
+		},
+		{
+			TableID:           "tags",
+			RowID:             "tag_javascript",
+			FieldName:         "tagfilename",
+			Source:            "images/javascript.png",
+			Destination:       "images/559.png",
+			SourceExists:      true,
+			DestinationAction: PlanOverwrite,
+		},
+		{
+			TableID:           "tags",
+			RowID:             "tag_javascript",
+			FieldName:         "tagthumbnail",
+			Source:            "images/javascript_thumb.png",
+			Destination:       "images/559_thumb.png",
+			SourceExists:      false,
+			DestinationAction: PlanCreate,
+		},
+	}, c.Plan())
+
+	assert.Equal(t, 0, len(c.Manifest()))
+	stat, err := destination.Stat("images/559.png")
+	assert.NilError(t, err)
+	assert.Equal(t, int64(0), stat.Size())
+}
+
+func TestPlanOverwriteIfDifferentUnresolved(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		tag  string
+	}{
+		{
+			name: "content",
+			tag:  `content: "javascript image"`,
+		},
+		{
+			name: "template",
+			tag: `source: "images/javascript.png"
+          template: true`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			destination := NewMemoryDestination()
+			writeTestFile(t, destination, "images/559.png", "javascript image")
+
+			c := New(
+				WithDryRun(),
+				WithSourceFS(fstest.MapFS{
+					"images/javascript.png": &fstest.MapFile{Data: []byte("javascript image")},
+				}),
+				WithDestination(destination),
+			)
+
+			_, err := resolveTestCopyFile(t, c, fmt.Sprintf(`tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tagfilename:
+          !copyfile
+          %s
+          destination: "images/{value:tag_id}.png"
+          overwrite: different
+`, test.tag))
+			assert.NilError(t, err)
+
+			plan := c.Plan()
+			assert.Equal(t, 1, len(plan))
+			assert.Equal(t, PlanOverwrite, plan[0].DestinationAction)
+		})
+	}
+}
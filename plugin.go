@@ -1,19 +1,51 @@
 package copyfile
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"sync"
+
 	"github.com/goccy/go-yaml"
 	"github.com/goccy/go-yaml/ast"
 	"github.com/rrgmc/debefix"
+	"golang.org/x/exp/maps"
 )
 
 // CopyFile is a debefix plugin to configure files to be copied during the data generation process.
 type CopyFile struct {
 	debefix.ValueImpl
-	sourcePath       string
-	destinationPath  string
-	getPathsCallback GetPathsCallback
-	getValueCallback GetValueCallback
-	copyFileCallback CopyFileCallback
+	ctx                     context.Context
+	sourcePath              string
+	sourceFS                fs.FS
+	destinationPath         string
+	destination             Destination
+	allowPathEscape         bool
+	overwritePolicy         OverwritePolicy
+	linkMode                LinkMode
+	verifyDestination       bool
+	generators              map[string]Generator
+	fieldFuncs              map[string]FieldFunc
+	sanitizePolicy          SanitizePolicy
+	sanitizeMaxLength       int
+	getPathsCallback        GetPathsCallback
+	getValueCallback        GetValueCallback
+	copyFileCallback        CopyFileCallback
+	copyFileFSCallback      CopyFileFSCallback
+	copyFileContextCallback CopyFileContextCallback
+	dryRun                  bool
+	isTransaction           bool
+	isDeferred              bool
+	workers                 int
+	queue                   []CopyFileInfo
+	queueIndex              map[string]int
+	transaction             *transactionDestination
+	m                       sync.Mutex
+	manifest                []ManifestEntry
+	plan                    []PlannedCopy
+	attributes              map[string]map[string]*fileAttributes // file attributes of the rows being resolved.
 }
 
 var (
@@ -32,34 +64,212 @@ func (c *CopyFile) ParseValue(tag *ast.TagNode) (bool, any, error) {
 	if err != nil {
 		return false, nil, err
 	}
+	if err = c.validateFileData(fileData); err != nil {
+		return false, nil, err
+	}
+	if len(fileData.Files) > 0 {
+		if countTrue(fileData.Source != "", fileData.Content != nil, fileData.Generate != nil) > 0 {
+			return false, nil, fmt.Errorf("source, content or generate cannot be set together with files")
+		}
+		ids := map[string]bool{}
+		for _, entry := range fileData.Files {
+			if len(entry.Files) > 0 || entry.ValueFrom != "" {
+				return false, nil, fmt.Errorf("files entries cannot contain files or value_from")
+			}
+			if err = c.validateFileData(entry); err != nil {
+				return false, nil, err
+			}
+			if entry.ID != "" {
+				if ids[entry.ID] {
+					return false, nil, fmt.Errorf("duplicated files entry id '%s'", entry.ID)
+				}
+				ids[entry.ID] = true
+			}
+		}
+		if fileData.ValueFrom != "" && !ids[fileData.ValueFrom] {
+			return false, nil, fmt.Errorf("value_from files entry id '%s' not found", fileData.ValueFrom)
+		}
+	} else if fileData.ValueFrom != "" {
+		return false, nil, fmt.Errorf("value_from can only be set together with files")
+	}
 
 	// return a [debefix.Value] to be processed later.
 	return true, &copyFileValue{cf: c, fileData: fileData}, nil
 }
 
+// validateFileData validates the fields of a !copyfile tag or of one of its files entries.
+func (c *CopyFile) validateFileData(fileData FileData) error {
+	if err := checkFileDataFields(fileData); err != nil {
+		return err
+	}
+	if !fileData.Overwrite.IsValid() {
+		return fmt.Errorf("invalid overwrite policy '%s'", fileData.Overwrite)
+	}
+	if !fileData.Mode.IsValid() {
+		return fmt.Errorf("invalid link mode '%s'", fileData.Mode)
+	}
+	if !fileData.Encoding.IsValid() {
+		return fmt.Errorf("invalid content encoding '%s'", fileData.Encoding)
+	}
+	if !fileData.Format.IsValid() {
+		return fmt.Errorf("invalid archive format '%s'", fileData.Format)
+	}
+	if fileData.isArchive() && (fileData.Content != nil || fileData.Generate != nil || fileData.Template) {
+		return fmt.Errorf("archives can only be extracted from source")
+	}
+	if fileData.SHA256 != "" {
+		if !isSHA256(fileData.SHA256) {
+			return fmt.Errorf("invalid sha256 '%s'", fileData.SHA256)
+		}
+		if fileData.isArchive() || len(fileData.Files) > 0 {
+			return fmt.Errorf("sha256 can only be set for single files")
+		}
+	}
+	if countTrue(fileData.Source != "", fileData.Content != nil, fileData.Generate != nil) > 1 {
+		return fmt.Errorf("only one of source, content or generate can be set")
+	}
+	if fileData.Generate != nil {
+		name, err := generatorName(fileData.Generate)
+		if err != nil {
+			return err
+		}
+		if _, ok := c.getGenerator(name); !ok {
+			return fmt.Errorf("unknown generator '%s'", name)
+		}
+	}
+	return nil
+}
+
+// checkFileDataFields checks that the strings where fields are replaced are valid, using ParseFieldsStrict.
+func checkFileDataFields(fileData FileData) error {
+	check := func(name string, str *string) error {
+		if str == nil {
+			return nil
+		}
+		if _, err := ParseFieldsStrict(*str); err != nil {
+			return fmt.Errorf("invalid %s '%s': %w", name, *str, err)
+		}
+		return nil
+	}
+
+	if err := check("value", fileData.Value); err != nil {
+		return err
+	}
+	if err := check("source", &fileData.Source); err != nil {
+		return err
+	}
+	if err := check("destination", &fileData.Destination); err != nil {
+		return err
+	}
+	if !fileData.Template && (fileData.Encoding == "" || fileData.Encoding == ContentText) {
+		// text content fields are replaced using ReplaceFieldsWithFilter.
+		if err := check("content", fileData.Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (c *CopyFile) RowResolved(ctx debefix.ValueResolveContext) error {
+	defer c.clearFileAttributes(ctx)
+	err := c.rowResolved(ctx)
+	if err != nil {
+		return errors.Join(err, c.Rollback())
+	}
+	return nil
+}
+
+func (c *CopyFile) rowResolved(ctx debefix.ValueResolveContext) error {
 	// after row was resolved, call the callback to copy the file
 	md := getMetadata(ctx.Row().Metadata)
-	for fieldname, file := range md.Fields {
-		getPathsCallback := c.getPathsCallback
-		if getPathsCallback == nil {
-			getPathsCallback = DefaultGetPathsCallback
+	fieldnames := maps.Keys(md.Fields)
+	slices.Sort(fieldnames)
+	for _, fieldname := range fieldnames {
+		for _, file := range md.Fields[fieldname].fileEntries() {
+			err := c.resolveField(ctx, fieldname, file)
+			if err != nil {
+				return err
+			}
 		}
-		source, destination, err := getPathsCallback(ctx, fieldname, file)
-		if err != nil {
+	}
+	return nil
+}
+
+// resolveField resolves the paths of the field file, expands directory and glob sources or extracts archives, and
+// copies the files.
+func (c *CopyFile) resolveField(ctx debefix.ValueResolveContext, fieldname string, file FileData) error {
+	getPathsCallback := c.getPathsCallback
+	if getPathsCallback == nil {
+		getPathsCallback = DefaultGetPathsCallback
+	}
+	attributes := c.getFileAttributes(ctx, fieldname, file)
+	source, destination, err := getPathsCallback(&fileResolveContext{
+		ValueResolveContext: ctx,
+		attributes:          attributes,
+	}, fieldname, file)
+	if err != nil {
+		return err
+	}
+
+	err = c.checkPaths(ctx, fieldname, source, destination)
+	if err != nil {
+		return err
+	}
+
+	if file.isArchive() {
+		return c.extractArchive(ctx, fieldname, file, source, destination, func(expanded expandedFile) error {
+			return c.copyExpandedFile(ctx, fieldname, file, expanded)
+		})
+	}
+
+	files, err := c.expandSource(file, source, destination)
+	if err != nil {
+		return err
+	}
+	for _, expanded := range files {
+		if loaded, ok := attributes.loadedContent(); ok && len(files) == 1 {
+			// content was already resolved by a file attribute placeholder.
+			expanded.content = loaded
+		}
+		if err = c.copyExpandedFile(ctx, fieldname, file, expanded); err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
-		copyFileCallback := c.copyFileCallback
-		if copyFileCallback == nil {
-			copyFileCallback = DefaultCopyFileCallback
-		}
-		err = copyFileCallback(c.sourcePath, source, c.destinationPath, destination)
+// copyExpandedFile copies, queues or plans the copy of an expanded file, resolving its content if needed.
+func (c *CopyFile) copyExpandedFile(ctx debefix.ValueResolveContext, fieldname string, file FileData,
+	expanded expandedFile) error {
+	content := expanded.content
+	if content == nil && expanded.entry == nil && !c.dryRun {
+		var err error
+		content, err = c.resolveContent(ctx, fieldname, file, expanded.source)
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+
+	info := CopyFileInfo{
+		TableID:        ctx.Table().ID,
+		RowID:          rowID(ctx.Row()),
+		FieldName:      fieldname,
+		FileData:       file,
+		Source:         expanded.source,
+		Destination:    expanded.destination,
+		Content:        content,
+		ResolveContext: ctx,
+		archiveEntry:   expanded.entry,
+	}
+	switch {
+	case c.dryRun:
+		return c.planCopy(info)
+	case c.isDeferred:
+		c.enqueueCopy(info)
+		return nil
+	default:
+		return c.copyFile(c.context(), info)
+	}
 }
 
 type copyFileValue struct {
@@ -80,7 +290,11 @@ func (c *copyFileValue) GetValueCallback(ctx debefix.ValueCallbackResolveContext
 	if getValueCallback == nil {
 		getValueCallback = DefaultGetValueCallback
 	}
-	return getValueCallback(ctx, c.fileData)
+	return getValueCallback(&fileValueCallbackResolveContext{
+		ValueCallbackResolveContext: ctx,
+		cf:                          c.cf,
+		attributes:                  c.cf.getFileAttributes(ctx, ctx.FieldName(), c.fileData),
+	}, c.fileData)
 }
 
 const (
@@ -107,3 +321,14 @@ func setMetadata(ctx debefix.ValueCallbackResolveContext, fileData FileData) {
 	md.Fields[ctx.FieldName()] = fileData
 	ctx.SetMetadata(metadataName, md)
 }
+
+// countTrue returns the number of true values.
+func countTrue(values ...bool) int {
+	count := 0
+	for _, v := range values {
+		if v {
+			count++
+		}
+	}
+	return count
+}
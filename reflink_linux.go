@@ -0,0 +1,34 @@
+package copyfile
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink creates newname as a copy-on-write clone of oldname using the FICLONE ioctl.
+func reflink(oldname, newname string) (err error) {
+	source, err := os.Open(oldname)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := os.OpenFile(newname, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, destination.Close())
+		if err != nil {
+			_ = os.Remove(newname)
+		}
+	}()
+
+	err = unix.IoctlFileClone(int(destination.Fd()), int(source.Fd()))
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.EXDEV) || errors.Is(err, unix.EINVAL) {
+		return errors.Join(errors.ErrUnsupported, err)
+	}
+	return err
+}
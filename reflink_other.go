@@ -0,0 +1,10 @@
+//go:build !linux
+
+package copyfile
+
+import "errors"
+
+// reflink is not supported on this platform.
+func reflink(oldname, newname string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,166 @@
+package copyfile
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// SanitizePolicy sets how values substituted into path templates are made filesystem-safe.
+// Unsafe characters are path separators, control characters and the ones invalid in Windows filenames
+// (:*?"<>|). Trailing dots and spaces, and the "." and ".." names, are also unsafe.
+type SanitizePolicy string
+
+const (
+	SanitizeEscape  SanitizePolicy = "escape"  // percent-encode unsafe characters and "%", like "a%2Fb".
+	SanitizeReplace SanitizePolicy = "replace" // replace unsafe characters with "_".
+	SanitizeReject  SanitizePolicy = "reject"  // return an error wrapping ErrUnsafePathValue.
+	SanitizeNone    SanitizePolicy = "none"    // use values unchanged.
+)
+
+const (
+	// DefaultSanitizePolicy is the sanitize policy used for path templates if not set.
+	DefaultSanitizePolicy = SanitizeEscape
+	// DefaultSanitizeMaxLength is the maximum length in bytes of a sanitized value, if not set.
+	DefaultSanitizeMaxLength = 255
+)
+
+// IsValid returns whether the policy is a known one. A blank policy is valid, and means the default one.
+func (p SanitizePolicy) IsValid() bool {
+	switch p {
+	case "", SanitizeEscape, SanitizeReplace, SanitizeReject, SanitizeNone:
+		return true
+	default:
+		return false
+	}
+}
+
+// SanitizeValue makes a value substituted into a path template filesystem-safe using the policy, after normalizing
+// it to Unicode NFC. Values longer than maxLength bytes after sanitization are truncated, or rejected when using
+// SanitizeReject. A maxLength <= 0 means no limit.
+func SanitizeValue(value string, policy SanitizePolicy, maxLength int) (string, error) {
+	if policy == "" {
+		policy = DefaultSanitizePolicy
+	}
+	if policy == SanitizeNone {
+		return value, nil
+	}
+	if !policy.IsValid() {
+		return "", fmt.Errorf("invalid sanitize policy '%s'", policy)
+	}
+
+	value = norm.NFC.String(value)
+
+	if policy == SanitizeReject {
+		if pos := unsafePathValueIndex(value); pos >= 0 {
+			return "", fmt.Errorf("%w: '%s' has an unsafe character at offset %d", ErrUnsafePathValue, value, pos)
+		}
+		if maxLength > 0 && len(value) > maxLength {
+			return "", fmt.Errorf("%w: '%s' is longer than %d bytes", ErrUnsafePathValue, value, maxLength)
+		}
+		return value, nil
+	}
+
+	ret := sanitizePathValue(value, policy)
+	// truncate the input until the sanitized value fits, so escapes and runes are never split.
+	for maxLength > 0 && len(ret) > maxLength {
+		_, size := utf8.DecodeLastRuneInString(value)
+		value = value[:len(value)-size]
+		ret = sanitizePathValue(value, policy)
+	}
+	return ret, nil
+}
+
+// sanitizePathValue escapes or replaces the unsafe characters of value.
+func sanitizePathValue(value string, policy SanitizePolicy) string {
+	if value == "" {
+		return ""
+	}
+
+	// trailing dots and spaces are unsafe, and a value with only dots would be the "." or ".." names.
+	safeEnd := len(strings.TrimRight(value, ". "))
+	if strings.Trim(value, ".") == "" && len(value) <= 2 {
+		safeEnd = 0
+	}
+
+	var sb strings.Builder
+	for i, ch := range value {
+		unsafe := i >= safeEnd || isUnsafePathRune(ch)
+		if policy == SanitizeEscape && ch == '%' {
+			unsafe = true
+		}
+		if !unsafe {
+			sb.WriteRune(ch)
+			continue
+		}
+		switch policy {
+		case SanitizeEscape:
+			for _, b := range []byte(string(ch)) {
+				_, _ = fmt.Fprintf(&sb, "%%%02X", b)
+			}
+		default:
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
+
+// unsafePathValueIndex returns the byte offset of the first unsafe character in value, or -1 if it is safe.
+func unsafePathValueIndex(value string) int {
+	if value == "." || value == ".." {
+		return 0
+	}
+	for i, ch := range value {
+		if isUnsafePathRune(ch) {
+			return i
+		}
+	}
+	if trimmed := strings.TrimRight(value, ". "); len(trimmed) < len(value) {
+		return len(trimmed)
+	}
+	return -1
+}
+
+func isUnsafePathRune(ch rune) bool {
+	if ch == utf8.RuneError || unicode.IsControl(ch) {
+		return true
+	}
+	return strings.ContainsRune(`/\:*?"<>|`, ch)
+}
+
+// sanitizeFieldValue sanitizes a field value, after its pipes were applied. Numbers and bools are used unchanged.
+// If splitPath is true, each "/"-separated part is sanitized on its own, and empty parts are removed, or rejected
+// using SanitizeReject.
+func sanitizeFieldValue(value any, splitPath bool, policy SanitizePolicy, maxLength int) (any, error) {
+	var str string
+	switch v := value.(type) {
+	case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v, nil
+	case string:
+		str = v
+	default:
+		str = fmt.Sprint(v)
+	}
+	if !splitPath || str == "" || policy == SanitizeNone {
+		return SanitizeValue(str, policy, maxLength)
+	}
+
+	var parts []string
+	for _, part := range strings.Split(str, "/") {
+		if part == "" {
+			if policy == SanitizeReject {
+				return nil, fmt.Errorf("%w: '%s' has an empty path element", ErrUnsafePathValue, str)
+			}
+			continue
+		}
+		sanitized, err := SanitizeValue(part, policy, maxLength)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, sanitized)
+	}
+	return strings.Join(parts, "/"), nil
+}
@@ -0,0 +1,121 @@
+package copyfile
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSanitizeValue(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		value       string
+		policy      SanitizePolicy
+		maxLength   int
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "safe",
+			value:    "tenant-1 ação",
+			policy:   SanitizeEscape,
+			expected: "tenant-1 ação",
+		},
+		{
+			name:     "escape",
+			value:    "a/b\\c:d*e?\"<>|%\x01",
+			policy:   SanitizeEscape,
+			expected: "a%2Fb%5Cc%3Ad%2Ae%3F%22%3C%3E%7C%25%01",
+		},
+		{
+			name:     "replace",
+			value:    "a/b\\c:d\x7f",
+			policy:   SanitizeReplace,
+			expected: "a_b_c_d_",
+		},
+		{
+			name:     "trailing dots and spaces",
+			value:    "tenant. .",
+			policy:   SanitizeReplace,
+			expected: "tenant___",
+		},
+		{
+			name:     "parent",
+			value:    "..",
+			policy:   SanitizeEscape,
+			expected: "%2E%2E",
+		},
+		{
+			name:     "leading dots",
+			value:    "..tenant",
+			policy:   SanitizeEscape,
+			expected: "..tenant",
+		},
+		{
+			name:     "none",
+			value:    "../a/b",
+			policy:   SanitizeNone,
+			expected: "../a/b",
+		},
+		{
+			name:     "default policy",
+			value:    "a/b",
+			expected: "a%2Fb",
+		},
+		{
+			name:     "nfc",
+			value:    "acaõ",
+			policy:   SanitizeEscape,
+			expected: "acaõ",
+		},
+		{
+			name:      "max length",
+			value:     "ação/tenant",
+			policy:    SanitizeEscape,
+			maxLength: 8,
+			expected:  "ação",
+		},
+		{
+			name:      "max length escape",
+			value:     "ab/cd",
+			policy:    SanitizeEscape,
+			maxLength: 4,
+			expected:  "ab",
+		},
+		{
+			name:        "reject",
+			value:       "a/b",
+			policy:      SanitizeReject,
+			expectedErr: ErrUnsafePathValue,
+		},
+		{
+			name:        "reject parent",
+			value:       "..",
+			policy:      SanitizeReject,
+			expectedErr: ErrUnsafePathValue,
+		},
+		{
+			name:        "reject max length",
+			value:       "tenant",
+			policy:      SanitizeReject,
+			maxLength:   3,
+			expectedErr: ErrUnsafePathValue,
+		},
+		{
+			name:     "reject safe",
+			value:    "tenant",
+			policy:   SanitizeReject,
+			expected: "tenant",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			value, err := SanitizeValue(test.value, test.policy, test.maxLength)
+			if test.expectedErr != nil {
+				assert.ErrorIs(t, err, test.expectedErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, test.expected, value)
+		})
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package copyfile
+
+import (
+	"errors"
+	"os"
+)
+
+// syncDir commits the directory entries to stable storage.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	return errors.Join(err, d.Close())
+}
@@ -0,0 +1,6 @@
+package copyfile
+
+// syncDir is a no-op on Windows, which doesn't support syncing directories.
+func syncDir(string) error {
+	return nil
+}
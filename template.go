@@ -0,0 +1,78 @@
+package copyfile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"text/template"
+
+	"github.com/rrgmc/debefix"
+)
+
+// TemplateData is the data available to templates rendered using [FileData.Template].
+// Besides it, the functions "filter" and "valueref" are available to extract values using debefix filter
+// expressions, like {{ filter "value:tag_id" }} and {{ valueref "tenant_id:tenants:tenant_id:name" }}.
+type TemplateData struct {
+	TableID   string
+	RowID     string
+	FieldName string
+	Fields    map[string]any // resolved row fields.
+	Metadata  map[string]any // row metadata.
+}
+
+// renderTemplate renders the source file, or the inline content, as a Go template.
+func (c *CopyFile) renderTemplate(ctx debefix.ValueResolveContext, fieldname string, fileData FileData,
+	source string) ([]byte, error) {
+	name := source
+	var content []byte
+	var err error
+	if fileData.Content != nil {
+		name = "content"
+		content, err = decodeContent(fileData)
+	} else {
+		content, err = c.readSource(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	filter := func(expr string) (any, error) {
+		return ctx.ResolvedData().ExtractValue(ctx.Row(), expr)
+	}
+
+	tmpl, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{
+			"filter": filter,
+			"valueref": func(expr string) (any, error) {
+				return filter("valueref:" + expr)
+			},
+		}).
+		Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template '%s': %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, TemplateData{
+		TableID:   ctx.Table().ID,
+		RowID:     rowID(ctx.Row()),
+		FieldName: fieldname,
+		Fields:    ctx.Row().Fields,
+		Metadata:  ctx.Row().Metadata,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error executing template '%s': %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// readSource reads the contents of the source file.
+func (c *CopyFile) readSource(source string) ([]byte, error) {
+	file, err := c.openSource(source)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
@@ -0,0 +1,78 @@
+package copyfile
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestTemplate(t *testing.T) {
+	destination := NewMemoryDestination()
+
+	resolveTestData(t, `tables:
+  tenants:
+    rows:
+      - tenant_id: 987
+        name: "Joomla"
+  tags:
+    config:
+      depends: ["tenants"]
+    rows:
+      - tag_id: 559
+        tenant_id: 987
+        _metadata:
+          !metadata
+          color: "blue"
+        tagconfig:
+          !copyfile
+          source: "config/tag.conf.tmpl"
+          destination: "config/{value:tag_id}.conf"
+          template: true
+`,
+		WithSourceFS(fstest.MapFS{
+			"config/tag.conf.tmpl": &fstest.MapFile{
+				Data: []byte(`table={{ .TableID }}
+field={{ .FieldName }}
+id={{ .Fields.tag_id }}
+tenant={{ valueref "tenant_id:tenants:tenant_id:name" }}
+color={{ .Metadata.color }}
+tag_id={{ filter "value:tag_id" }}
+`),
+			},
+		}),
+		WithDestination(destination),
+	)
+
+	content, err := fs.ReadFile(destination, "config/559.conf")
+	assert.NilError(t, err)
+	assert.Equal(t, `table=tags
+field=tagconfig
+id=559
+tenant=Joomla
+color=blue
+tag_id=559
+`, string(content))
+}
+
+func TestTemplateError(t *testing.T) {
+	_, err := resolveTestDataErr(t, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tagconfig:
+          !copyfile
+          source: "config/tag.conf.tmpl"
+          destination: "config/{value:tag_id}.conf"
+          template: true
+`,
+		WithSourceFS(fstest.MapFS{
+			"config/tag.conf.tmpl": &fstest.MapFile{
+				Data: []byte("id={{ .Fields.tag_id }}\nname={{ .Fields.tag_name }}\n"),
+			},
+		}),
+		WithDestination(NewMemoryDestination()),
+	)
+	assert.ErrorContains(t, err, "config/tag.conf.tmpl:2:")
+}
@@ -0,0 +1,278 @@
+package copyfile
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/rrgmc/debefix"
+)
+
+// Commit keeps all files written since the start of the transaction, or since the last Commit or Rollback.
+// It is a no-op if not in transaction mode.
+func (c *CopyFile) Commit() error {
+	if c.transaction == nil {
+		return nil
+	}
+	return c.transaction.commit()
+}
+
+// Rollback removes all files and directories created since the start of the transaction, or since the last Commit
+// or Rollback, and restores the files that were overwritten.
+// It is a no-op if not in transaction mode.
+func (c *CopyFile) Rollback() error {
+	if c.transaction == nil {
+		return nil
+	}
+	return c.transaction.rollback()
+}
+
+// Resolve calls [debefix.Resolve] using the plugin as the row resolved callback. In deferred mode, the queued copies
+// are flushed after a successful resolve. In transaction mode, the written files are rolled back if resolve fails.
+func (c *CopyFile) Resolve(data *debefix.Data, f debefix.ResolveCallback,
+	options ...debefix.ResolveOption) (*debefix.Data, error) {
+	resolvedData, err := debefix.Resolve(data, f, append(options, debefix.WithRowResolvedCallback(c))...)
+	if err != nil {
+		c.clearQueue()
+		c.clearFileAttributes(nil)
+		return nil, errors.Join(err, c.Rollback())
+	}
+	if err = c.Flush(c.context()); err != nil {
+		return nil, err
+	}
+	return resolvedData, nil
+}
+
+// transactionDestination is a [LinkDestination] which records all created files and directories, and backs up the
+// overwritten files, so they can be rolled back.
+type transactionDestination struct {
+	Destination
+	m       sync.Mutex
+	dirs    []string          // created directories, in creation order.
+	files   map[string]bool   // created or overwritten files.
+	backups map[string]string // overwritten files and the name of their backup.
+}
+
+var _ LinkDestination = (*transactionDestination)(nil)
+
+func newTransactionDestination(destination Destination) *transactionDestination {
+	return &transactionDestination{
+		Destination: destination,
+		files:       map[string]bool{},
+		backups:     map[string]string{},
+	}
+}
+
+func (d *transactionDestination) MkdirAll(name string, perm fs.FileMode) error {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	// find which directories don't exist yet, they will be created.
+	var created []string
+	var current string
+	for _, part := range strings.Split(path.Clean(name), "/") {
+		current = path.Join(current, part)
+		if current == "." {
+			continue
+		}
+		if exists, err := destinationExists(d.Destination, current); err != nil {
+			return err
+		} else if !exists {
+			created = append(created, current)
+		}
+	}
+
+	err := d.Destination.MkdirAll(name, perm)
+	for _, dir := range created {
+		// record even on error, as some directories may have been created.
+		if exists, _ := destinationExists(d.Destination, dir); exists {
+			d.dirs = append(d.dirs, dir)
+		}
+	}
+	return err
+}
+
+func (d *transactionDestination) Create(name string) (DestinationFile, error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	// the file is truncated in place, so it can be moved to the backup.
+	if err := d.backup(name, false); err != nil {
+		return nil, err
+	}
+	file, err := d.Destination.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	d.files[name] = true
+	return file, nil
+}
+
+func (d *transactionDestination) Rename(oldname, newname string) error {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if err := d.backup(newname, true); err != nil {
+		return err
+	}
+	if err := d.Destination.Rename(oldname, newname); err != nil {
+		return err
+	}
+	// oldname may be a temporary link created in this transaction, which doesn't exist anymore.
+	delete(d.files, oldname)
+	d.files[newname] = true
+	return nil
+}
+
+func (d *transactionDestination) Symlink(oldname, newname string) error {
+	return d.link(oldname, newname, func(destination LinkDestination) func(string, string) error {
+		return destination.Symlink
+	})
+}
+
+func (d *transactionDestination) Link(oldname, newname string) error {
+	return d.link(oldname, newname, func(destination LinkDestination) func(string, string) error {
+		return destination.Link
+	})
+}
+
+func (d *transactionDestination) Reflink(oldname, newname string) error {
+	return d.link(oldname, newname, func(destination LinkDestination) func(string, string) error {
+		return destination.Reflink
+	})
+}
+
+// link creates a link using the wrapped destination, if it supports links.
+func (d *transactionDestination) link(oldname, newname string,
+	linkFunc func(destination LinkDestination) func(string, string) error) error {
+	linkDestination, ok := d.Destination.(LinkDestination)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if err := d.backup(newname, false); err != nil {
+		return err
+	}
+	if err := linkFunc(linkDestination)(oldname, newname); err != nil {
+		return err
+	}
+	d.files[newname] = true
+	return nil
+}
+
+// backup backs up the existing file, if it wasn't created or backed up in this transaction.
+// If keep is true, the file is kept in place, so an atomic rename can still replace it without the file ever missing.
+// It is backed up as a hard link if the destination supports it, or as a copy otherwise.
+// If keep is false, the file is moved to the backup.
+func (d *transactionDestination) backup(name string, keep bool) error {
+	if d.files[name] {
+		return nil
+	}
+	if exists, err := destinationExists(d.Destination, name); err != nil || !exists {
+		return err
+	}
+
+	pattern := "." + path.Base(name) + ".*.bak"
+	if linker, ok := d.Destination.(localLinker); ok && keep {
+		backupName, err := tryTempName(path.Dir(name), pattern, func(backupName string) error {
+			return linker.linkLocal(name, backupName)
+		})
+		if err == nil {
+			d.backups[name] = backupName
+			return nil
+		}
+		// fallback to copy.
+	}
+
+	backupFile, err := d.Destination.CreateTemp(path.Dir(name), pattern)
+	if err != nil {
+		return err
+	}
+	if keep {
+		err = copyDestinationFile(d.Destination, name, backupFile)
+	} else {
+		err = backupFile.Close()
+		if err == nil {
+			err = d.Destination.Rename(name, backupFile.Name())
+		}
+	}
+	if err != nil {
+		return errors.Join(err, d.Destination.Remove(backupFile.Name()))
+	}
+	d.backups[name] = backupFile.Name()
+	return nil
+}
+
+// copyDestinationFile copies the named destination file to the target file, closing it.
+func copyDestinationFile(destination Destination, name string, target DestinationFile) error {
+	file, err := destination.Open(name)
+	if err != nil {
+		return errors.Join(err, target.Close())
+	}
+	defer file.Close()
+
+	if _, err = io.Copy(target, file); err != nil {
+		return errors.Join(err, target.Close())
+	}
+	if err = target.Sync(); err != nil {
+		return errors.Join(err, target.Close())
+	}
+	return target.Close()
+}
+
+func (d *transactionDestination) commit() error {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	var errs []error
+	for _, backupName := range d.backups {
+		errs = append(errs, d.Destination.Remove(backupName))
+	}
+	d.reset()
+	return errors.Join(errs...)
+}
+
+func (d *transactionDestination) rollback() error {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	var errs []error
+	for name := range d.files {
+		if _, ok := d.backups[name]; !ok {
+			errs = append(errs, d.Destination.Remove(name))
+		}
+	}
+	for name, backupName := range d.backups {
+		errs = append(errs, d.Destination.Rename(backupName, name))
+	}
+	// remove directories in reverse order, so children are removed before their parents.
+	for i := len(d.dirs) - 1; i >= 0; i-- {
+		errs = append(errs, d.Destination.Remove(d.dirs[i]))
+	}
+	d.reset()
+	return errors.Join(errs...)
+}
+
+func (d *transactionDestination) reset() {
+	d.dirs = nil
+	d.files = map[string]bool{}
+	d.backups = map[string]string{}
+}
+
+// localLinker is implemented by destinations which can create hard links between their own files.
+// It must return an error wrapping [fs.ErrExist] if newname already exists.
+type localLinker interface {
+	linkLocal(oldname, newname string) error
+}
+
+// destinationExists returns whether the named file exists in the destination.
+func destinationExists(destination Destination, name string) (bool, error) {
+	_, err := destination.Stat(name)
+	return existsResult(err)
+}
@@ -0,0 +1,239 @@
+package copyfile
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/rrgmc/debefix"
+	"gotest.tools/v3/assert"
+)
+
+func TestTransaction(t *testing.T) {
+	errResolve := errors.New("resolve error")
+
+	for _, test := range []struct {
+		name       string
+		failTagID  uint64
+		expectedFS map[string]string
+	}{
+		{
+			name: "commit",
+			expectedFS: map[string]string{
+				"images/559.png":      "javascript image",
+				"images/new/560.png":  "golang image",
+				"images/existing.png": "existing image",
+			},
+		},
+		{
+			name:      "rollback",
+			failTagID: 560,
+			expectedFS: map[string]string{
+				"images/559.png":      "old image",
+				"images/existing.png": "existing image",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			destination := NewMemoryDestination()
+			writeTestFile(t, destination, "images/559.png", "old image")
+			writeTestFile(t, destination, "images/existing.png", "existing image")
+
+			c := New(
+				WithSourceFS(fstest.MapFS{
+					"images/javascript.png": &fstest.MapFile{Data: []byte("javascript image")},
+					"images/golang.png":     &fstest.MapFile{Data: []byte("golang image")},
+				}),
+				WithDestination(destination),
+				WithTransaction(),
+			)
+
+			data, err := debefix.Load(debefix.NewFSFileProvider(fstest.MapFS{
+				"data.dbf.yaml": &fstest.MapFile{Data: []byte(`tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tag_name: "javascript"
+        tagfilename:
+          !copyfile
+          source: "images/{value:tag_name}.png"
+          destination: "images/{value:tag_id}.png"
+      - tag_id: 560
+        tag_name: "golang"
+        tagfilename:
+          !copyfile
+          source: "images/{value:tag_name}.png"
+          destination: "images/new/{value:tag_id}.png"
+`)},
+			}), debefix.WithLoadValueParser(c))
+			assert.NilError(t, err)
+
+			_, err = c.Resolve(data, func(ctx debefix.ResolveContext, fields map[string]any) error {
+				if fields["tag_id"] == test.failTagID {
+					return errResolve
+				}
+				return nil
+			})
+			if test.failTagID != 0 {
+				assert.ErrorIs(t, err, errResolve)
+			} else {
+				assert.NilError(t, err)
+				assert.NilError(t, c.Commit())
+			}
+
+			var files []string
+			err = fs.WalkDir(destination, ".", func(path string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				files = append(files, path)
+				return nil
+			})
+			assert.NilError(t, err)
+
+			// no backup files must be left behind.
+			assert.Equal(t, len(test.expectedFS), len(files), "files: %v", files)
+			for fn, content := range test.expectedFS {
+				fileContent, err := fs.ReadFile(destination, fn)
+				assert.NilError(t, err)
+				assert.Equal(t, content, string(fileContent))
+			}
+
+			if test.failTagID != 0 {
+				_, err = destination.Stat("images/new")
+				assert.ErrorIs(t, err, fs.ErrNotExist)
+			}
+		})
+	}
+}
+
+func TestTransactionLinkMode(t *testing.T) {
+	sourcePath := t.TempDir()
+	destinationPath := t.TempDir()
+	assert.NilError(t, os.MkdirAll(filepath.Join(sourcePath, "images"), 0o755))
+	assert.NilError(t, os.WriteFile(filepath.Join(sourcePath, "images", "javascript.png"),
+		[]byte("javascript image"), 0o644))
+
+	c := New(
+		WithSourcePath(sourcePath),
+		WithDestinationPath(destinationPath),
+		WithLinkMode(LinkSymlink),
+		WithTransaction(),
+	)
+	_, err := resolveTestCopyFile(t, c, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tagfilename:
+          !copyfile
+          source: "images/javascript.png"
+          destination: "images/{value:tag_id}.png"
+`)
+	assert.NilError(t, err)
+
+	stat, err := os.Lstat(filepath.Join(destinationPath, "images", "559.png"))
+	assert.NilError(t, err)
+	assert.Assert(t, stat.Mode()&fs.ModeSymlink != 0)
+
+	assert.NilError(t, c.Rollback())
+
+	entries, err := os.ReadDir(destinationPath)
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(entries))
+}
+
+func TestTransactionReplaceInPlace(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		destination func(t *testing.T) Destination
+	}{
+		{
+			name: "memory",
+			destination: func(t *testing.T) Destination {
+				return NewMemoryDestination()
+			},
+		},
+		{
+			name: "os",
+			destination: func(t *testing.T) Destination {
+				return NewOSDestination(t.TempDir())
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			destination := &renameCheckDestination{Destination: test.destination(t), name: "images/559.png"}
+			writeTestFile(t, destination.Destination, "images/559.png", "old image")
+
+			c := New(
+				WithSourceFS(fstest.MapFS{
+					"images/javascript.png": &fstest.MapFile{Data: []byte("javascript image")},
+				}),
+				WithDestination(destination),
+				WithTransaction(),
+			)
+			_, err := resolveTestCopyFile(t, c, `tables:
+  tags:
+    rows:
+      - tag_id: 559
+        tagfilename:
+          !copyfile
+          source: "images/javascript.png"
+          destination: "images/{value:tag_id}.png"
+`)
+			assert.NilError(t, err)
+			assert.Assert(t, destination.replaced)
+
+			content, err := fs.ReadFile(destination, "images/559.png")
+			assert.NilError(t, err)
+			assert.Equal(t, "javascript image", string(content))
+
+			assert.NilError(t, c.Rollback())
+			content, err = fs.ReadFile(destination, "images/559.png")
+			assert.NilError(t, err)
+			assert.Equal(t, "old image", string(content))
+
+			entries, err := fs.ReadDir(destination, "images")
+			assert.NilError(t, err)
+			assert.Equal(t, 1, len(entries))
+		})
+	}
+}
+
+// renameCheckDestination checks that the named file exists when it is replaced by a rename.
+type renameCheckDestination struct {
+	Destination
+	name     string
+	replaced bool
+}
+
+func (d *renameCheckDestination) Rename(oldname, newname string) error {
+	if newname == d.name && !d.replaced {
+		exists, err := destinationExists(d.Destination, newname)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return errors.New("file replaced by rename doesn't exist")
+		}
+		d.replaced = true
+	}
+	return d.Destination.Rename(oldname, newname)
+}
+
+func (d *renameCheckDestination) linkLocal(oldname, newname string) error {
+	if linker, ok := d.Destination.(localLinker); ok {
+		return linker.linkLocal(oldname, newname)
+	}
+	return errors.ErrUnsupported
+}
+
+// writeTestFile writes a file to the destination, creating the directories if needed.
+func writeTestFile(t *testing.T, destination Destination, name string, content string) {
+	t.Helper()
+	_, err := writeDestinationFile(strings.NewReader(content), destination, name, OverwriteAlways)
+	assert.NilError(t, err)
+}
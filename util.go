@@ -1,32 +1,37 @@
 package copyfile
 
 import (
-	"bytes"
-	"io"
+	"unicode/utf8"
 )
 
 type parser struct {
-	r *bytes.Reader
+	str      string
+	pos      int
+	lastSize int
 }
 
 func newParser(str string) parser {
-	return parser{r: bytes.NewReader([]byte(str))}
+	return parser{str: str}
 }
 
 func (p *parser) next() (rune, bool) {
-	ch, _, err := p.r.ReadRune()
-	if err != nil {
-		if err != io.EOF {
-			panic(err)
-		}
+	if p.pos >= len(p.str) {
+		p.lastSize = 0
 		return 0, false
 	}
+	ch, size := utf8.DecodeRuneInString(p.str[p.pos:])
+	p.pos += size
+	p.lastSize = size
 	return ch, true
 }
 
+// offset returns the byte offset of the next rune.
+func (p *parser) offset() int {
+	return p.pos
+}
+
+// unread unreads the last rune returned by next. It is a no-op if called more than once.
 func (p *parser) unread() {
-	err := p.r.UnreadRune()
-	if err != nil {
-		panic(err)
-	}
+	p.pos -= p.lastSize
+	p.lastSize = 0
 }
@@ -0,0 +1,204 @@
+package copyfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+)
+
+// OverwritePolicy sets what to do when a destination file already exists.
+type OverwritePolicy string
+
+const (
+	OverwriteAlways      OverwritePolicy = "always"    // always overwrite the existing file.
+	OverwriteError       OverwritePolicy = "error"     // return an error wrapping ErrDestinationExists.
+	OverwriteSkip        OverwritePolicy = "skip"      // keep the existing file.
+	OverwriteIfDifferent OverwritePolicy = "different" // overwrite only if the content is different.
+)
+
+// IsValid returns whether the policy is a known one. A blank policy is valid, and means the default one.
+func (p OverwritePolicy) IsValid() bool {
+	switch p {
+	case "", OverwriteAlways, OverwriteError, OverwriteSkip, OverwriteIfDifferent:
+		return true
+	default:
+		return false
+	}
+}
+
+// writeResult is the result of writing a destination file.
+type writeResult struct {
+	written bool   // false if the file was not written because of the overwrite policy.
+	size    int64  // number of bytes written.
+	sha256  string // hex-encoded SHA-256 of the written contents.
+}
+
+// writeDestinationFile writes the contents of source to the destination file, creating the directories if needed.
+func writeDestinationFile(source io.Reader, destination Destination, destinationFilename string,
+	overwritePolicy OverwritePolicy) (writeResult, error) {
+	source, proceed, err := checkOverwrite(source, destination, destinationFilename, overwritePolicy)
+	if err != nil || !proceed {
+		return writeResult{}, err
+	}
+
+	err = destination.MkdirAll(path.Dir(destinationFilename), os.ModePerm)
+	if err != nil {
+		return writeResult{}, err
+	}
+
+	return writeFileAtomic(source, destination, destinationFilename, nil)
+}
+
+// checkOverwrite checks the overwrite policy if the destination file exists. It returns false if the file must not
+// be written. As the source may be consumed by the check, the returned reader must be used instead of it.
+func checkOverwrite(source io.Reader, destination Destination, destinationFilename string,
+	overwritePolicy OverwritePolicy) (io.Reader, bool, error) {
+	if overwritePolicy == OverwriteAlways {
+		return source, true, nil
+	}
+
+	stat, err := destination.Stat(destinationFilename)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return source, true, nil
+	case err != nil:
+		return nil, false, err
+	case !stat.Mode().IsRegular():
+		return nil, false, fmt.Errorf("%s is not a regular file", destinationFilename)
+	}
+
+	switch overwritePolicy {
+	case OverwriteError:
+		return nil, false, fmt.Errorf("%w: %s", ErrDestinationExists, destinationFilename)
+	case OverwriteSkip:
+		return source, false, nil
+	case OverwriteIfDifferent:
+		source, equal, err := compareDestinationFile(source, destination, destinationFilename, stat.Size())
+		if err != nil {
+			return nil, false, err
+		}
+		return source, !equal, nil
+	default:
+		return nil, false, fmt.Errorf("invalid overwrite policy '%s'", overwritePolicy)
+	}
+}
+
+// writeFileAtomic writes the contents of source to a temporary file in the same directory of the destination file,
+// syncs it and renames it to the destination filename, so readers never see a partially written file.
+// If check is not nil, it is called before the rename, and the file is not renamed if it returns an error.
+func writeFileAtomic(source io.Reader, destination Destination, destinationFilename string,
+	check func(result writeResult) error) (_ writeResult, err error) {
+	file, err := destination.CreateTemp(path.Dir(destinationFilename), "."+path.Base(destinationFilename)+".*.tmp")
+	if err != nil {
+		return writeResult{}, err
+	}
+	isClosed := false
+	defer func() {
+		if err != nil {
+			if !isClosed {
+				_ = file.Close()
+			}
+			_ = destination.Remove(file.Name())
+		}
+	}()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), source)
+	if err != nil {
+		return writeResult{}, err
+	}
+	if err = file.Sync(); err != nil {
+		return writeResult{}, err
+	}
+	isClosed = true
+	if err = file.Close(); err != nil {
+		return writeResult{}, err
+	}
+	result := writeResult{
+		written: true,
+		size:    size,
+		sha256:  hex.EncodeToString(hash.Sum(nil)),
+	}
+	if check != nil {
+		if err = check(result); err != nil {
+			return writeResult{}, err
+		}
+	}
+	if err = destination.Rename(file.Name(), destinationFilename); err != nil {
+		return writeResult{}, err
+	}
+	return result, nil
+}
+
+// compareDestinationFile compares the contents of source with the existing destination file.
+// As the source is consumed, it returns a new reader with the same contents as the original source.
+func compareDestinationFile(source io.Reader, destination Destination, destinationFilename string,
+	destinationSize int64) (io.Reader, bool, error) {
+	seeker, isSeeker := source.(io.ReadSeeker)
+	if !isSeeker {
+		data, err := io.ReadAll(source)
+		if err != nil {
+			return nil, false, err
+		}
+		seeker = bytes.NewReader(data)
+	}
+
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, false, err
+	}
+	sourceSize, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err = seeker.Seek(start, io.SeekStart); err != nil {
+		return nil, false, err
+	}
+	if sourceSize-start != destinationSize {
+		return seeker, false, nil
+	}
+
+	destinationFile, err := destination.Open(destinationFilename)
+	if err != nil {
+		return nil, false, err
+	}
+	defer destinationFile.Close()
+
+	equal, err := readersEqual(seeker, destinationFile)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err = seeker.Seek(start, io.SeekStart); err != nil {
+		return nil, false, err
+	}
+	return seeker, equal, nil
+}
+
+// readersEqual returns whether both readers have the same content.
+func readersEqual(r1, r2 io.Reader) (bool, error) {
+	const bufferSize = 32 * 1024
+	buf1 := make([]byte, bufferSize)
+	buf2 := make([]byte, bufferSize)
+	for {
+		n1, err1 := io.ReadFull(r1, buf1)
+		if err1 != nil && err1 != io.EOF && err1 != io.ErrUnexpectedEOF {
+			return false, err1
+		}
+		n2, err2 := io.ReadFull(r2, buf2)
+		if err2 != nil && err2 != io.EOF && err2 != io.ErrUnexpectedEOF {
+			return false, err2
+		}
+		if !bytes.Equal(buf1[:n1], buf2[:n2]) {
+			return false, nil
+		}
+		if err1 != nil || err2 != nil {
+			return err1 != nil && err2 != nil, nil
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package copyfile
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	errClose := errors.New("close error")
+	errRead := errors.New("read error")
+
+	for _, test := range []struct {
+		name        string
+		source      io.Reader
+		closeErr    error
+		expectedErr error
+	}{
+		{
+			name:   "success",
+			source: strings.NewReader("new content"),
+		},
+		{
+			name:        "read error",
+			source:      io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errRead)),
+			expectedErr: errRead,
+		},
+		{
+			name:        "close error",
+			source:      strings.NewReader("new content"),
+			closeErr:    errClose,
+			expectedErr: errClose,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			destination := NewMemoryDestination()
+			assert.NilError(t, destination.MkdirAll("images", 0o755))
+			f, err := destination.Create("images/file.txt")
+			assert.NilError(t, err)
+			_, err = f.Write([]byte("old content"))
+			assert.NilError(t, err)
+			assert.NilError(t, f.Close())
+
+			_, err = writeFileAtomic(test.source, &closeErrorDestination{Destination: destination, err: test.closeErr},
+				"images/file.txt", nil)
+
+			content, rerr := fs.ReadFile(destination, "images/file.txt")
+			assert.NilError(t, rerr)
+
+			if test.expectedErr != nil {
+				assert.ErrorIs(t, err, test.expectedErr)
+				assert.Equal(t, "old content", string(content))
+			} else {
+				assert.NilError(t, err)
+				assert.Equal(t, "new content", string(content))
+			}
+
+			// no temporary files must be left behind.
+			entries, err := fs.ReadDir(destination, "images")
+			assert.NilError(t, err)
+			assert.Equal(t, 1, len(entries))
+		})
+	}
+}
+
+type closeErrorDestination struct {
+	Destination
+	err error
+}
+
+func (d *closeErrorDestination) CreateTemp(dir, pattern string) (DestinationFile, error) {
+	file, err := d.Destination.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &closeErrorFile{DestinationFile: file, err: d.err}, nil
+}
+
+type closeErrorFile struct {
+	DestinationFile
+	err error
+}
+
+func (f *closeErrorFile) Close() error {
+	return errors.Join(f.DestinationFile.Close(), f.err)
+}